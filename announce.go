@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// announceTimeout bounds how long an announce webhook may take to respond.
+const announceTimeout = 10 * time.Second
+
+// announcement is the JSON body posted to the announce webhook. Content
+// holds a ready-made message for services like Discord that post it as is.
+type announcement struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Content string `json:"content"`
+}
+
+// getAnnounceWebhook returns the URL to announce new posts to, or "" when
+// unset or not an http(s) URL.
+func getAnnounceWebhook(db *sql.DB) string {
+	value, _ := getSetting(db, "announce_webhook")
+	if !isHTTPURL(value) {
+		return ""
+	}
+	return value
+}
+
+// announcePost posts a newly published post's title and URL to the
+// announce webhook, if one is set. It runs in the background so a slow or
+// failing webhook never holds up publishing; failures are only logged.
+func (b *Blog) announcePost(title, postURL string) {
+	webhook := getAnnounceWebhook(b.db)
+	if webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(announcement{
+		Title:   title,
+		URL:     postURL,
+		Content: fmt.Sprintf("New post: %s %s", title, postURL),
+	})
+	if err != nil {
+		log.Printf("encoding announcement: %v", err)
+		return
+	}
+
+	go func() {
+		resp, err := b.client.Post(webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("announcing %s: %v", postURL, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusMultipleChoices {
+			log.Printf("announcing %s: webhook responded %s", postURL, resp.Status)
+		}
+	}()
+}
+
+// setAnnouncePending marks whether a post scheduled for later still has to
+// be announced when its publish time comes.
+func setAnnouncePending(db *sql.DB, postID int, pending bool) error {
+	_, err := db.Exec("UPDATE posts SET announce_pending = ? WHERE id = ?", pending, postID)
+	if err != nil {
+		return fmt.Errorf("marking post %d for announcement: %w", postID, err)
+	}
+	return nil
+}
+
+// announceDuePosts announces scheduled posts whose publish time has passed.
+// It runs on public requests, so a post is announced by the first visit or
+// feed poll after it goes live. Each post is claimed before it's announced
+// so concurrent requests can't announce it twice.
+func (b *Blog) announceDuePosts(r *http.Request) {
+	posts, err := queryPosts(b.db, "SELECT "+postColumns+" FROM posts WHERE announce_pending = 1 AND "+publicPosts)
+	if err != nil {
+		log.Printf("fetching posts to announce: %v", err)
+		return
+	}
+
+	for _, post := range posts {
+		res, err := b.db.Exec("UPDATE posts SET announce_pending = 0 WHERE id = ? AND announce_pending = 1", post.ID)
+		if err != nil {
+			log.Printf("claiming post %d for announcement: %v", post.ID, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		b.announcePost(post.Title, requestBaseURL(r)+"/"+post.Slug)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// apiPost is a post as listed by the JSON API.
+type apiPost struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Slug      string `json:"slug"`
+	CreatedAt string `json:"created_at"`
+	Excerpt   string `json:"excerpt"`
+	Draft     bool   `json:"draft,omitempty"`
+}
+
+// apiPostDetail is a single post from the JSON API, with its content
+// rendered to HTML.
+type apiPostDetail struct {
+	apiPost
+	ContentHTML string `json:"content_html"`
+}
+
+// apiError is the body of every JSON API error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func newAPIPost(post Post) apiPost {
+	return apiPost{
+		ID:        post.ID,
+		Title:     post.Title,
+		Slug:      post.Slug,
+		CreatedAt: post.CreatedAt.UTC().Format(time.RFC3339),
+		Excerpt:   post.Summary(160),
+		Draft:     !post.IsPublic(),
+	}
+}
+
+// writeJSON encodes v as the response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("encoding JSON response: %v", err)
+	}
+}
+
+// APIPosts lists posts as JSON: published ones for visitors, and drafts and
+// scheduled posts too for a logged-in admin.
+func (b *Blog) APIPosts(w http.ResponseWriter, r *http.Request) {
+	var posts []Post
+	var err error
+	if b.isAuthenticated(r) {
+		posts, err = b.posts.GetPosts()
+	} else {
+		posts, err = b.posts.GetPublishedPosts()
+	}
+	if err != nil {
+		log.Printf("fetching posts for API: %v", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{"internal server error"})
+		return
+	}
+
+	items := make([]apiPost, len(posts))
+	for i, post := range posts {
+		items[i] = newAPIPost(post)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// APIPost returns a single post as JSON. Posts visitors can't see are a 404
+// unless the request comes from a logged-in admin.
+func (b *Blog) APIPost(w http.ResponseWriter, r *http.Request) {
+	post, err := b.posts.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		log.Printf("fetching post for API: %v", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{"internal server error"})
+		return
+	}
+	if post == nil || (!post.IsPublic() && !b.isAuthenticated(r)) {
+		writeJSON(w, http.StatusNotFound, apiError{"post not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiPostDetail{
+		apiPost:     newAPIPost(*post),
+		ContentHTML: string(format(absoluteLinks(post.Content, requestBaseURL(r)))),
+	})
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"database/sql"
 	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -19,12 +24,18 @@ const (
 	csrfCookieName    = "csrf"
 	csrfFieldName     = "csrf_token"
 	sessionDuration   = 24 * time.Hour
+	// rememberDuration is the session length when "Remember me" is checked.
+	rememberDuration = 30 * 24 * time.Hour
 )
 
 var (
 	adminUsername string
 	adminPassword string
 	secureCookies bool
+	forceHTTPS    bool
+	trustProxy    bool
+	cookieDomain  string
+	canonicalHost string
 )
 
 func initAuth() {
@@ -41,14 +52,52 @@ func initAuth() {
 	adminPassword = mustHashPassword(pass)
 
 	secureCookies = os.Getenv("SECURE_COOKIES") == "true"
+	forceHTTPS = os.Getenv("FORCE_HTTPS") == "true"
+	trustProxy = os.Getenv("TRUST_PROXY") == "true"
+
+	cookieDomain = os.Getenv("COOKIE_DOMAIN")
+	if cookieDomain != "" && !cookieDomainRegex.MatchString(cookieDomain) {
+		log.Printf("WARNING: ignoring invalid COOKIE_DOMAIN %q", cookieDomain)
+		cookieDomain = ""
+	}
+
+	canonicalHost = os.Getenv("CANONICAL_HOST")
+	if canonicalHost != "" && !canonicalHostRegex.MatchString(canonicalHost) {
+		log.Printf("WARNING: ignoring invalid CANONICAL_HOST %q", canonicalHost)
+		canonicalHost = ""
+	}
 }
 
-func mustHashPassword(password string) string {
+// cookieDomainRegex loosely matches a hostname, optionally with a leading dot.
+var cookieDomainRegex = regexp.MustCompile(`^\.?[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// canonicalHostRegex loosely matches a hostname, optionally with a port.
+var canonicalHostRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*(:[0-9]+)?$`)
+
+func hashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func mustHashPassword(password string) string {
+	hash, err := hashPassword(password)
 	if err != nil {
 		panic(err)
 	}
-	return string(hash)
+	return hash
+}
+
+// adminPasswordHash returns the admin's bcrypt hash: the one saved from
+// Settings when the password has been changed, or else the one derived
+// from ADMIN_PASS at startup.
+func adminPasswordHash(db *sql.DB) string {
+	if hash, _ := getSetting(db, "admin_password_hash"); hash != "" {
+		return hash
+	}
+	return adminPassword
 }
 
 func checkPassword(hash, password string) bool {
@@ -65,12 +114,17 @@ func generateToken() (string, error) {
 }
 
 func createSession(db *sql.DB, userID int) (string, error) {
+	return createSessionWithDuration(db, userID, sessionDuration)
+}
+
+// createSessionWithDuration creates a session that expires after d.
+func createSessionWithDuration(db *sql.DB, userID int, d time.Duration) (string, error) {
 	token, err := generateToken()
 	if err != nil {
 		return "", fmt.Errorf("generating session token: %w", err)
 	}
 
-	expiresAt := time.Now().Add(sessionDuration)
+	expiresAt := time.Now().Add(d)
 	_, err = db.Exec(`
 		INSERT INTO sessions (token, user_id, expires_at)
 		VALUES (?, ?, ?)`, token, userID, expiresAt)
@@ -99,6 +153,25 @@ func getSession(db *sql.DB, token string) (*Session, error) {
 	return &session, nil
 }
 
+// sessionRefreshWindow is how close to expiry a session must be before
+// using it extends it, so most requests don't need a write.
+const sessionRefreshWindow = time.Hour
+
+// touchSession extends session to sessionDuration from now if it is within
+// sessionRefreshWindow of expiring. It reports whether it did.
+func touchSession(db *sql.DB, session *Session) (bool, error) {
+	if time.Until(session.ExpiresAt) > sessionRefreshWindow {
+		return false, nil
+	}
+	expiresAt := time.Now().Add(sessionDuration)
+	_, err := db.Exec("UPDATE sessions SET expires_at = ? WHERE token = ?", expiresAt, session.Token)
+	if err != nil {
+		return false, fmt.Errorf("extending session: %w", err)
+	}
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
 func deleteSession(db *sql.DB, token string) error {
 	_, err := db.Exec("DELETE FROM sessions WHERE token = ?", token)
 	if err != nil {
@@ -107,14 +180,155 @@ func deleteSession(db *sql.DB, token string) error {
 	return nil
 }
 
+// deleteTokenDuration is how long a delete confirmation page stays usable.
+const deleteTokenDuration = time.Hour
+
+// createDeleteToken issues a one-time token, embedded in the delete
+// confirmation page, that authorizes deleting postID.
+func createDeleteToken(db *sql.DB, postID int) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", fmt.Errorf("generating delete token: %w", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO delete_tokens (token, post_id, expires_at)
+		VALUES (?, ?, ?)`, token, postID, time.Now().Add(deleteTokenDuration))
+	if err != nil {
+		return "", fmt.Errorf("inserting delete token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeDeleteToken reports whether token is an unexpired delete token
+// for postID, removing it so it can't be used again.
+func consumeDeleteToken(db *sql.DB, token string, postID int) (bool, error) {
+	result, err := db.Exec(`
+		DELETE FROM delete_tokens
+		WHERE token = ? AND post_id = ? AND expires_at > ?`, token, postID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("consuming delete token: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("consuming delete token: %w", err)
+	}
+	return n == 1, nil
+}
+
 func cleanupExpiredSessions(db *sql.DB) error {
 	_, err := db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now())
 	if err != nil {
 		return fmt.Errorf("cleaning up expired sessions: %w", err)
 	}
+	_, err = db.Exec("DELETE FROM delete_tokens WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return fmt.Errorf("cleaning up expired delete tokens: %w", err)
+	}
 	return nil
 }
 
+const (
+	// maxLoginFailures is how many failed logins a client gets per
+	// loginFailureWindow before further attempts are refused.
+	maxLoginFailures   = 5
+	loginFailureWindow = 15 * time.Minute
+)
+
+// rateLimiter counts events per key, such as failed logins per client IP,
+// in fixed windows starting at each key's first event. Counts are kept in
+// memory and reset on restart.
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	counts map[string]*rateCount
+	// nextSweep is when expired counts are next dropped, so the sweep
+	// runs at most once per window rather than on every event.
+	nextSweep time.Time
+}
+
+type rateCount struct {
+	count   int
+	resetAt time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{window: window, counts: make(map[string]*rateCount)}
+}
+
+// allow reports whether key has recorded fewer than limit events in its
+// current window.
+func (l *rateLimiter) allow(key string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.counts[key]
+	return !ok || time.Now().After(c.resetAt) || c.count < limit
+}
+
+// record counts an event for key and returns the count so far in its window.
+func (l *rateLimiter) record(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.After(l.nextSweep) {
+		for k, c := range l.counts {
+			if now.After(c.resetAt) {
+				delete(l.counts, k)
+			}
+		}
+		l.nextSweep = now.Add(l.window)
+	}
+	c, ok := l.counts[key]
+	if !ok || now.After(c.resetAt) {
+		c = &rateCount{resetAt: now.Add(l.window)}
+		l.counts[key] = c
+	}
+	c.count++
+	return c.count
+}
+
+// reset clears key's count, e.g. after a successful login.
+func (l *rateLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.counts, key)
+}
+
+// clientIP returns the IP address the request came from. Behind a reverse
+// proxy (TRUST_PROXY=true) that is the last X-Forwarded-For entry, the one
+// the proxy appended itself; earlier entries can be forged by the client.
+// Otherwise it is the connection's address.
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setSessionCookie(w http.ResponseWriter, token string, duration time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   cookieDomain,
+		HttpOnly: true,
+		Secure:   secureCookies,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(duration.Seconds()),
+	})
+}
+
 // CSRF protection using double-submit cookie pattern
 
 func generateCSRFToken() (string, error) {
@@ -126,6 +340,7 @@ func setCSRFCookie(w http.ResponseWriter, token string) {
 		Name:     csrfCookieName,
 		Value:    token,
 		Path:     "/",
+		Domain:   cookieDomain,
 		HttpOnly: false, // JS needs to read this if doing AJAX (not needed here, but standard)
 		Secure:   secureCookies,
 		SameSite: http.SameSiteStrictMode,
@@ -179,6 +394,26 @@ func ensureCSRFToken(w http.ResponseWriter, r *http.Request) string {
 	return token
 }
 
+// sessionContextKey is the request context key requireAuth stores the session under.
+type sessionContextKey struct{}
+
+// currentUserID returns the user ID of the session attached by requireAuth,
+// or 0 if the request didn't pass through it.
+func currentUserID(r *http.Request) int {
+	if session, ok := r.Context().Value(sessionContextKey{}).(*Session); ok {
+		return session.UserID
+	}
+	return 0
+}
+
+// userName returns the display name for a user ID.
+func userName(userID int) string {
+	if userID == 1 {
+		return adminUsername
+	}
+	return fmt.Sprintf("user %d", userID)
+}
+
 // requireAuth is middleware that protects routes requiring authentication
 func (b *Blog) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -194,10 +429,60 @@ func (b *Blog) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next(w, r)
+		// Keep active admins signed in past the original expiry
+		if touched, err := touchSession(b.db, session); err != nil {
+			log.Printf("touching session: %v", err)
+		} else if touched {
+			setSessionCookie(w, session.Token, sessionDuration)
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
 	}
 }
 
+// maintenanceExemptPaths stay reachable for everyone during maintenance
+// so health checks keep working and the admin can still log in.
+var maintenanceExemptPaths = map[string]bool{
+	"/healthz": true,
+	"/login":   true,
+	"/admin":   true,
+}
+
+// maintenance is middleware that serves a 503 maintenance page to
+// unauthenticated visitors while maintenance mode is on.
+func (b *Blog) maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maintenanceExemptPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/static/") ||
+			!isMaintenanceMode(b.db) || b.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "3600")
+		b.errorPage(w, r, http.StatusServiceUnavailable, "This site is down for maintenance. Please check back shortly.")
+	})
+}
+
+// redirectHTTPS is middleware that permanently redirects plain http
+// requests to https when FORCE_HTTPS is set, on CANONICAL_HOST if one is
+// configured. Health checks are exempt since load balancers usually probe
+// over plain http.
+func redirectHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !forceHTTPS || r.URL.Path == "/healthz" || requestScheme(r) == "https" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := canonicalHost
+		if host == "" {
+			host = r.Host
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
 // isAuthenticated checks if the current request has a valid session
 func (b *Blog) isAuthenticated(r *http.Request) bool {
 	cookie, err := r.Cookie(sessionCookieName)
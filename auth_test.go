@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 // addCSRFTokenAuth adds a CSRF token to the request (cookie + form value)
@@ -87,6 +88,33 @@ func TestCreateAndGetSession(t *testing.T) {
 	}
 }
 
+func TestCreateSessionWithDuration(t *testing.T) {
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	defer db.Close()
+
+	if err = initDB(db); err != nil {
+		t.Fatalf("initializing test database: %v", err)
+	}
+
+	token, err := createSessionWithDuration(db, 1, rememberDuration)
+	if err != nil {
+		t.Fatalf("createSessionWithDuration() error: %v", err)
+	}
+
+	session, err := getSession(db, token)
+	if err != nil || session == nil {
+		t.Fatalf("getSession() = %v, %v", session, err)
+	}
+
+	want := time.Now().Add(30 * 24 * time.Hour)
+	if diff := session.ExpiresAt.Sub(want).Abs(); diff > time.Minute {
+		t.Errorf("expected session to expire around %v, got %v", want, session.ExpiresAt)
+	}
+}
+
 func TestGetSession_NotFound(t *testing.T) {
 	db, err := openDB(":memory:")
 	if err != nil {
@@ -148,6 +176,30 @@ func TestLogin_GET(t *testing.T) {
 	}
 }
 
+func TestLogin_GET_UsesBlogName(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	setSetting(blog.db, "blog_name", "Quiet Nothings")
+	setSetting(blog.db, "login_message", "Authors only, please.")
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	w := httptest.NewRecorder()
+
+	blog.Login(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<h1>Quiet Nothings</h1>") {
+		t.Error("expected login heading to use the configured blog name")
+	}
+	if !strings.Contains(body, "Authors only, please.") {
+		t.Error("expected login message in response")
+	}
+}
+
 func TestLogin_POST_Success(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -183,6 +235,116 @@ func TestLogin_POST_Success(t *testing.T) {
 	}
 }
 
+func TestLogin_POST_RememberMe(t *testing.T) {
+	tests := []struct {
+		name     string
+		remember string
+		want     time.Duration
+	}{
+		{"unchecked", "", sessionDuration},
+		{"checked", "true", rememberDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+
+			form := url.Values{}
+			form.Set("username", "admin")
+			form.Set("password", "password")
+			form.Set("remember", tt.remember)
+
+			req := httptest.NewRequest(http.MethodPost, "/login", nil)
+			addCSRFTokenAuth(req, form)
+			req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			blog.Login(w, req)
+
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookieName && c.MaxAge != int(tt.want.Seconds()) {
+					t.Errorf("expected cookie MaxAge %d, got %d", int(tt.want.Seconds()), c.MaxAge)
+				}
+			}
+		})
+	}
+}
+
+func TestLogin_POST_DashboardOnLogin(t *testing.T) {
+	blog := setupTestBlog(t)
+	setSetting(blog.db, "dashboard_on_login", "true")
+
+	form := url.Values{}
+	form.Set("username", "admin")
+	form.Set("password", "password")
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	addCSRFTokenAuth(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Login(w, req)
+
+	if got := w.Header().Get("Location"); got != "/dashboard" {
+		t.Errorf("expected redirect to /dashboard, got %q", got)
+	}
+}
+
+func TestLogin_POST_CookieDomain(t *testing.T) {
+	blog := setupTestBlog(t)
+	cookieDomain = ".example.com"
+	t.Cleanup(func() { cookieDomain = "" })
+
+	form := url.Values{}
+	form.Set("username", "admin")
+	form.Set("password", "password")
+
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	addCSRFTokenAuth(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Login(w, req)
+
+	var found bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			found = true
+			if c.Domain != "example.com" {
+				t.Errorf("expected session cookie domain example.com, got %q", c.Domain)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected session cookie to be set")
+	}
+}
+
+func TestCookieDomainRegex(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"example.com", true},
+		{".example.com", true},
+		{"blog.example.co.uk", true},
+		{"localhost", true},
+		{"", false},
+		{"..example.com", false},
+		{"example.com; Secure", false},
+		{"-example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := cookieDomainRegex.MatchString(tt.domain); got != tt.want {
+			t.Errorf("cookieDomainRegex.MatchString(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
 func TestLogin_POST_InvalidCredentials(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -207,6 +369,81 @@ func TestLogin_POST_InvalidCredentials(t *testing.T) {
 	}
 }
 
+func TestLogin_POST_RateLimited(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	login := func(password, remoteAddr string) int {
+		form := url.Values{}
+		form.Set("username", "admin")
+		form.Set("password", password)
+
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		addCSRFTokenAuth(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		blog.Login(w, req)
+		return w.Code
+	}
+
+	for i := 1; i <= maxLoginFailures; i++ {
+		if code := login("wrongpassword", "192.0.2.1:1234"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := login("wrongpassword", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after %d failures, got %d", http.StatusTooManyRequests, maxLoginFailures, code)
+	}
+	// Even the right password is refused until the window passes
+	if code := login("password", "192.0.2.1:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("expected correct password to be refused while limited, got %d", code)
+	}
+
+	// Other clients are unaffected, and a success clears their failures
+	login("wrongpassword", "192.0.2.2:1234")
+	if code := login("password", "192.0.2.2:1234"); code != http.StatusSeeOther {
+		t.Errorf("expected other client to log in, got %d", code)
+	}
+	if _, ok := blog.logins.counts["192.0.2.2"]; ok {
+		t.Error("expected successful login to reset the failure count")
+	}
+}
+
+func TestLogin_POST_RateLimitedBehindProxy(t *testing.T) {
+	blog := setupTestBlog(t)
+	trustProxy = true
+	t.Cleanup(func() { trustProxy = false })
+
+	login := func(forwardedFor string) int {
+		form := url.Values{}
+		form.Set("username", "admin")
+		form.Set("password", "wrongpassword")
+
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		addCSRFTokenAuth(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		blog.Login(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < maxLoginFailures; i++ {
+		login("192.0.2.1")
+	}
+	if code := login("192.0.2.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d for the limited client, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := login("192.0.2.2"); code != http.StatusUnauthorized {
+		t.Errorf("expected another client behind the same proxy to be unaffected, got %d", code)
+	}
+}
+
 func TestLogin_POST_NoCSRF(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -278,6 +515,44 @@ func TestRequireAuth_ValidSession(t *testing.T) {
 	}
 }
 
+func TestRequireAuth_ExtendsSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		wantExtend bool
+	}{
+		{"fresh session untouched", 20 * time.Hour, false},
+		{"near expiry extended", 10 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+
+			token, _ := createSessionWithDuration(blog.db, 1, tt.expiresIn)
+
+			handler := blog.requireAuth(func(w http.ResponseWriter, r *http.Request) {})
+			req := httptest.NewRequest(http.MethodGet, "/new", nil)
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			session, _ := getSession(blog.db, token)
+			if session == nil {
+				t.Fatal("expected session to still be valid")
+			}
+			extended := time.Until(session.ExpiresAt) > sessionDuration-time.Minute
+			if extended != tt.wantExtend {
+				t.Errorf("session extended = %v, want %v (expires %v)", extended, tt.wantExtend, session.ExpiresAt)
+			}
+			if refreshed := len(w.Result().Cookies()) > 0; refreshed != tt.wantExtend {
+				t.Errorf("cookie refreshed = %v, want %v", refreshed, tt.wantExtend)
+			}
+		})
+	}
+}
+
 func TestLogout(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -312,3 +587,248 @@ func TestLogout(t *testing.T) {
 		}
 	}
 }
+
+func TestMaintenance(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Visible Post", "Content", true)
+	setSetting(blog.db, "maintenance_mode", "true")
+
+	handler := blog.maintenance(http.HandlerFunc(blog.Home))
+	token, _ := createSession(blog.db, 1)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"anonymous home", "/", "", http.StatusServiceUnavailable},
+		{"authenticated home", "/", token, http.StatusOK},
+		{"anonymous login page", "/login", "", http.StatusOK},
+		{"anonymous health check", "/healthz", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.token})
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestMaintenance_EnvOverride(t *testing.T) {
+	blog := setupTestBlog(t)
+	t.Setenv("MAINTENANCE_MODE", "true")
+
+	handler := blog.maintenance(http.HandlerFunc(blog.Home))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "down for maintenance") {
+		t.Error("expected maintenance page in response")
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	forceHTTPS = true
+	t.Cleanup(func() { forceHTTPS = false })
+
+	handler := redirectHTTPS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		path          string
+		proto         string
+		trustProxy    bool
+		canonicalHost string
+		wantStatus    int
+		wantLocation  string
+	}{
+		{"plain http redirects", "/some-post?page=2", "", false, "", http.StatusMovedPermanently, "https://example.com/some-post?page=2"},
+		{"forwarded http redirects", "/", "http", true, "", http.StatusMovedPermanently, "https://example.com/"},
+		{"forwarded https passes", "/", "https", true, "", http.StatusOK, ""},
+		{"forwarded https ignored without trusted proxy", "/", "https", false, "", http.StatusMovedPermanently, "https://example.com/"},
+		{"invalid forwarded proto is ignored", "/", "gopher", true, "", http.StatusMovedPermanently, "https://example.com/"},
+		{"canonical host", "/some-post", "", false, "blog.example.org", http.StatusMovedPermanently, "https://blog.example.org/some-post"},
+		{"health check exempt", "/healthz", "", false, "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustProxy = tt.trustProxy
+			canonicalHost = tt.canonicalHost
+			t.Cleanup(func() {
+				trustProxy = false
+				canonicalHost = ""
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = "example.com"
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("expected Location %q, got %q", tt.wantLocation, got)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Record(t *testing.T) {
+	limiter := newRateLimiter(50 * time.Millisecond)
+
+	limiter.record("a")
+	if got := limiter.record("a"); got != 2 {
+		t.Errorf("expected count 2 within the window, got %d", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	limiter.record("b")
+	if _, ok := limiter.counts["a"]; ok {
+		t.Error("expected the expired count to be swept once the window passed")
+	}
+	if got := limiter.record("a"); got != 1 {
+		t.Errorf("expected a fresh count after the window, got %d", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  []string
+		want       string
+	}{
+		{"connection address by default", false, nil, "10.0.0.1"},
+		{"forwarded header ignored by default", false, []string{"192.0.2.1"}, "10.0.0.1"},
+		{"trusted proxy without header", true, nil, "10.0.0.1"},
+		{"trusted proxy", true, []string{"192.0.2.1"}, "192.0.2.1"},
+		{"last hop is the one the proxy added", true, []string{"198.51.100.7, 192.0.2.1"}, "192.0.2.1"},
+		{"last header wins", true, []string{"198.51.100.7", "192.0.2.1"}, "192.0.2.1"},
+		{"invalid header falls back", true, []string{"unknown"}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustProxy = tt.trustProxy
+			t.Cleanup(func() { trustProxy = false })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		newPass    string
+		confirm    string
+		wantStatus int
+		wantError  string
+	}{
+		{"wrong current password", "wrong", "newpassword", "newpassword", http.StatusUnauthorized, "Current password is incorrect"},
+		{"too short", "password", "short", "short", http.StatusBadRequest, "at least 8 characters"},
+		{"too long", "password", strings.Repeat("x", 73), strings.Repeat("x", 73), http.StatusBadRequest, "at most 72 bytes"},
+		{"confirmation mismatch", "password", "newpassword", "otherpassword", http.StatusBadRequest, "don&#39;t match"},
+		{"success", "password", "newpassword", "newpassword", http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+
+			form := url.Values{}
+			form.Set("current_password", tt.current)
+			form.Set("new_password", tt.newPass)
+			form.Set("confirm_password", tt.confirm)
+
+			req := httptest.NewRequest(http.MethodPost, "/settings/password", nil)
+			addCSRFTokenAuth(req, form)
+			req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			blog.ChangePassword(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantError != "" && !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("expected settings page with error %q", tt.wantError)
+			}
+
+			changed := tt.wantError == ""
+			if got := checkPassword(adminPasswordHash(blog.db), "newpassword"); got != changed {
+				t.Errorf("new password accepted = %v, want %v", got, changed)
+			}
+			if got := checkPassword(adminPasswordHash(blog.db), "password"); got == changed {
+				t.Errorf("old password accepted = %v, want %v", got, !changed)
+			}
+		})
+	}
+}
+
+func TestChangePassword_RateLimited(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	change := func(current string) int {
+		form := url.Values{}
+		form.Set("current_password", current)
+		form.Set("new_password", "newpassword")
+		form.Set("confirm_password", "newpassword")
+
+		req := httptest.NewRequest(http.MethodPost, "/settings/password", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		addCSRFTokenAuth(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		blog.ChangePassword(w, req)
+		return w.Code
+	}
+
+	for i := 1; i <= maxLoginFailures; i++ {
+		if code := change("wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := change("password"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after %d failures, got %d", http.StatusTooManyRequests, maxLoginFailures, code)
+	}
+	if checkPassword(adminPasswordHash(blog.db), "newpassword") {
+		t.Error("expected the password to stay unchanged while limited")
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"log"
+	"os"
 
 	_ "modernc.org/sqlite"
 )
@@ -39,6 +41,42 @@ func initDB(db *sql.DB) error {
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS post_tags (
+		post_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (post_id, tag_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS delete_tokens (
+		token TEXT PRIMARY KEY,
+		post_id INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS post_redirects (
+		slug TEXT PRIMARY KEY,
+		post_id INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS deleted_posts_archive (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		slug TEXT,
+		content TEXT NOT NULL,
+		published BOOLEAN NOT NULL,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME,
+		archived_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
 
 	_, err := db.Exec(schema)
@@ -93,6 +131,103 @@ func migrateDB(db *sql.DB) error {
 		}
 	}
 
+	// Every existing post was written by the single admin (user 1)
+	if err := addColumnIfMissing(db, "posts", "last_edited_by", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "canonical_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "noindex", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "language", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "translation_of", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "og_image", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "publish_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "excerpt", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "template", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "admin_notes", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "pinned", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "pin_until", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "show_related", "BOOLEAN NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "posts", "announce_pending", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Slugs only need to be unique among posts outside the trash, so a
+	// trashed post's slug can be reused when reuse_deleted_slugs is on
+	if _, err := db.Exec(`DROP INDEX IF EXISTS idx_posts_slug`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_live_slug ON posts(slug) WHERE deleted_at IS NULL`); err != nil {
+		return err
+	}
+
+	// SQLite can't add a column with a CURRENT_TIMESTAMP default, so
+	// backfill existing posts from created_at instead
+	if err := addColumnIfMissing(db, "posts", "updated_at", "DATETIME"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE posts SET updated_at = strftime('%Y-%m-%d %H:%M:%S', created_at) || '.000000' WHERE updated_at IS NULL`); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("adding column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
@@ -118,7 +253,7 @@ func migrateExistingSlugs(db *sql.DB) error {
 	}
 
 	for _, p := range posts {
-		slug := generateSlug(p.title)
+		slug := generateSlug(p.title, "")
 		uniqueSlug, err := ensureUniqueSlug(db, slug, p.id)
 		if err != nil {
 			return err
@@ -132,21 +267,24 @@ func migrateExistingSlugs(db *sql.DB) error {
 	return nil
 }
 
-func seedDB(db *sql.DB) error {
+// defaultSeedPosts are the example posts a fresh database starts with.
+var defaultSeedPosts = []Post{
+	{Title: "Hey now", Content: "Everything is awesome!", Published: true},
+	{Title: "What's the deal?", Content: "What is happening?!", Published: true},
+	{Title: "Football", Content: "Niners and stuff.", Published: true},
+}
+
+// seedDB inserts posts into a database that has none yet and reports it to
+// logger. Pass a logger writing to io.Discard to seed quietly.
+func seedDB(db *sql.DB, posts []Post, logger *log.Logger) error {
 	var count int
 	if err := db.QueryRow("SELECT COUNT(*) FROM posts").Scan(&count); err != nil {
 		return err
 	}
-	if count > 0 {
+	if count > 0 || len(posts) == 0 {
 		return nil
 	}
 
-	posts := []Post{
-		{Title: "Hey now", Content: "Everything is awesome!", Published: true},
-		{Title: "What's the deal?", Content: "What is happening?!", Published: true},
-		{Title: "Football", Content: "Niners and stuff.", Published: true},
-	}
-
 	stmt := "INSERT INTO posts (title, content, published) VALUES (?, ?, ?)"
 	for _, post := range posts {
 		_, err := db.Exec(stmt, post.Title, post.Content, post.Published)
@@ -155,21 +293,45 @@ func seedDB(db *sql.DB) error {
 		}
 	}
 
-	fmt.Println("successfully seeded test data")
+	logger.Printf("seeded %d example posts", len(posts))
 	return nil
 }
 
+// settingDefaults are seeded into a fresh database. The environment
+// variable, when set, takes precedence over the built-in default.
+var settingDefaults = []struct {
+	key      string
+	env      string
+	fallback string
+}{
+	{"intro", "", "Lorem ipsum dolor sit amet consectetur adipisicing elit. Dicta incidunt ipsa numquam impedit nostrum, ut cum a autem soluta animi, error, ea tenetur?"},
+	{"theme", "DEFAULT_THEME", ""},
+	{"font", "DEFAULT_FONT", ""},
+	{"blog_name", "DEFAULT_BLOG_NAME", ""},
+}
+
 func seedSettings(db *sql.DB) error {
-	// Seed default intro text if not exists
-	var count int
-	if err := db.QueryRow("SELECT COUNT(*) FROM settings WHERE key = 'intro'").Scan(&count); err != nil {
-		return err
-	}
-	if count > 0 {
-		return nil
-	}
+	for _, d := range settingDefaults {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM settings WHERE key = ?", d.key).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
 
-	defaultIntro := "Lorem ipsum dolor sit amet consectetur adipisicing elit. Dicta incidunt ipsa numquam impedit nostrum, ut cum a autem soluta animi, error, ea tenetur?"
-	_, err := db.Exec("INSERT INTO settings (key, value) VALUES (?, ?)", "intro", defaultIntro)
-	return err
+		value := d.fallback
+		if d.env != "" && os.Getenv(d.env) != "" {
+			value = os.Getenv(d.env)
+		}
+		if value == "" {
+			continue
+		}
+
+		if _, err := db.Exec("INSERT INTO settings (key, value) VALUES (?, ?)", d.key, value); err != nil {
+			return err
+		}
+	}
+	settingsCacheFor(db).invalidate()
+	return nil
 }
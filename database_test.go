@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io"
+	"log"
+	"os"
 	"testing"
 )
 
@@ -119,7 +122,7 @@ func TestSeedDB(t *testing.T) {
 		t.Fatalf("initDB() error: %v", err)
 	}
 
-	if err := seedDB(db); err != nil {
+	if err := seedDB(db, defaultSeedPosts, log.New(io.Discard, "", 0)); err != nil {
 		t.Fatalf("seedDB() error: %v", err)
 	}
 
@@ -150,7 +153,7 @@ func TestSeedDB_SkipsWhenDataExists(t *testing.T) {
 	}
 
 	// Seed should skip
-	if err := seedDB(db); err != nil {
+	if err := seedDB(db, defaultSeedPosts, log.New(io.Discard, "", 0)); err != nil {
 		t.Fatalf("seedDB() error: %v", err)
 	}
 
@@ -163,6 +166,44 @@ func TestSeedDB_SkipsWhenDataExists(t *testing.T) {
 	}
 }
 
+func TestSeedDB_Quiet(t *testing.T) {
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("openDB() error: %v", err)
+	}
+	defer db.Close()
+
+	if err := initDB(db); err != nil {
+		t.Fatalf("initDB() error: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = seedDB(db, []Post{{Title: "Only", Content: "Custom seed", Published: true}}, log.New(io.Discard, "", 0))
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatalf("seedDB() error: %v", err)
+	}
+
+	output, _ := io.ReadAll(r)
+	if len(output) != 0 {
+		t.Errorf("expected no output, got %q", output)
+	}
+
+	var title string
+	if err := db.QueryRow("SELECT title FROM posts").Scan(&title); err != nil {
+		t.Fatalf("reading seeded post: %v", err)
+	}
+	if title != "Only" {
+		t.Errorf("expected the given seed post, got %q", title)
+	}
+}
+
 func TestSeedSettings(t *testing.T) {
 	db, err := openDB(":memory:")
 	if err != nil {
@@ -216,3 +257,49 @@ func TestSeedSettings_SkipsWhenExists(t *testing.T) {
 		t.Errorf("expected 'Custom intro', got %q", value)
 	}
 }
+
+func TestSeedSettings_EnvDefaults(t *testing.T) {
+	t.Setenv("DEFAULT_THEME", "sepia")
+	t.Setenv("DEFAULT_FONT", "monospace")
+	t.Setenv("DEFAULT_BLOG_NAME", "Seeded Blog")
+
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("openDB() error: %v", err)
+	}
+	defer db.Close()
+
+	if err := initDB(db); err != nil {
+		t.Fatalf("initDB() error: %v", err)
+	}
+
+	// An existing value must not be replaced by the env default
+	if err := setSetting(db, "font", "sans-serif"); err != nil {
+		t.Fatalf("setSetting() error: %v", err)
+	}
+
+	if err := seedSettings(db); err != nil {
+		t.Fatalf("seedSettings() error: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"theme", "sepia"},
+		{"font", "sans-serif"},
+		{"blog_name", "Seeded Blog"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, err := getSetting(db, tt.key)
+			if err != nil {
+				t.Fatalf("getSetting() error: %v", err)
+			}
+			if value != tt.want {
+				t.Errorf("expected %s %q, got %q", tt.key, tt.want, value)
+			}
+		})
+	}
+}
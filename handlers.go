@@ -1,14 +1,28 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type rss struct {
@@ -21,123 +35,950 @@ type rssChannel struct {
 	Title       string    `xml:"title"`
 	Link        string    `xml:"link"`
 	Description string    `xml:"description"`
+	Image       *rssImage `xml:"image,omitempty"`
 	Items       []rssItem `xml:"item"`
 }
 
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
 type rssItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	GUID        string `xml:"guid"`
-	PubDate     string `xml:"pubDate"`
-	Description string `xml:"description"`
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        string        `xml:"guid"`
+	Author      string        `xml:"author,omitempty"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Logo    string      `xml:"logo,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// jsonFeed is a JSON Feed 1.1 document, see https://jsonfeed.org/version/1.1.
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	Summary       string `json:"summary,omitempty"`
+	DatePublished string `json:"date_published"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// articleJSONLD is the schema.org Article structured data for a post.
+type articleJSONLD struct {
+	Context          string       `json:"@context"`
+	Type             string       `json:"@type"`
+	Headline         string       `json:"headline"`
+	DatePublished    string       `json:"datePublished"`
+	DateModified     string       `json:"dateModified"`
+	Author           jsonLDPerson `json:"author"`
+	MainEntityOfPage string       `json:"mainEntityOfPage"`
+}
+
+type jsonLDPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+func newArticleJSONLD(post *Post, author, pageURL string) *articleJSONLD {
+	return &articleJSONLD{
+		Context:          "https://schema.org",
+		Type:             "Article",
+		Headline:         post.Title,
+		DatePublished:    post.CreatedAt.UTC().Format(time.RFC3339),
+		DateModified:     post.LastModified().UTC().Format(time.RFC3339),
+		Author:           jsonLDPerson{Type: "Person", Name: author},
+		MainEntityOfPage: pageURL,
+	}
 }
 
 func (b *Blog) render(w http.ResponseWriter, tmpl string, data map[string]any) {
-	if err := b.templates[tmpl].ExecuteTemplate(w, "base", data); err != nil {
+	if os.Getenv("MINIFY") != "true" {
+		if err := b.templates[tmpl].ExecuteTemplate(w, "base", data); err != nil {
+			log.Printf("rendering template %s: %v", tmpl, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := b.templates[tmpl].ExecuteTemplate(&buf, "base", data); err != nil {
 		log.Printf("rendering template %s: %v", tmpl, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
+	w.Write([]byte(minifyHTML(buf.String())))
 }
 
+// errorTitles are the headings errorPage shows for the statuses it is used
+// with. Other statuses fall back to their standard text.
+var errorTitles = map[int]string{
+	http.StatusNotFound:            "Not found",
+	http.StatusInternalServerError: "Something went wrong",
+	http.StatusServiceUnavailable:  "Down for maintenance",
+}
+
+// errorPage renders error.html with the given status and message. The page
+// is rendered before anything is written so that, if the template itself
+// fails, a plain http.Error can still go out.
+func (b *Blog) errorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	title, ok := errorTitles[status]
+	if !ok {
+		title = http.StatusText(status)
+	}
+
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":           title,
+		"Status":          status,
+		"Message":         message,
+		"IsAuthenticated": b.isAuthenticated(r),
+		"CSRFToken":       ensureCSRFToken(w, r),
+		"Theme":           theme,
+		"Font":            font,
+		"BlogName":        blogName,
+	}
+
+	var buf bytes.Buffer
+	if err := b.templates["error.html"].ExecuteTemplate(&buf, "base", data); err != nil {
+		log.Printf("rendering error page for %d: %v", status, err)
+		http.Error(w, message, status)
+		return
+	}
+	page := buf.String()
+	if os.Getenv("MINIFY") == "true" {
+		page = minifyHTML(page)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(page))
+}
+
+// NotFound renders the site's 404 page.
+func (b *Blog) NotFound(w http.ResponseWriter, r *http.Request) {
+	b.errorPage(w, r, http.StatusNotFound, "There's nothing here. The post may have been moved or deleted.")
+}
+
+// serverError renders the site's 500 page. The cause should already have
+// been logged by the caller.
+func (b *Blog) serverError(w http.ResponseWriter, r *http.Request) {
+	b.errorPage(w, r, http.StatusInternalServerError, "Something broke on our end. Please try again in a moment.")
+}
+
+// truncate shortens s to at most max bytes plus an ellipsis, cutting at the
+// last word boundary so words aren't split. A single word longer than max
+// is cut at a rune boundary instead.
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
 	}
-	return s[:max] + "..."
+	cut := s[:max]
+	for len(cut) > 0 && !utf8.RuneStart(s[len(cut)]) {
+		cut = cut[:len(cut)-1]
+	}
+	if next, _ := utf8.DecodeRuneInString(s[len(cut):]); !unicode.IsSpace(next) {
+		if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, " \t\n,;:") + "..."
+}
+
+// requestScheme returns the scheme the request was made with, honoring
+// X-Forwarded-Proto behind a trusted reverse proxy (TRUST_PROXY=true).
+// Values other than http or https are ignored.
+func requestScheme(r *http.Request) string {
+	if trustProxy {
+		switch proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto {
+		case "http", "https":
+			return proto
+		}
+	}
+	if r.TLS == nil {
+		return "http"
+	}
+	return "https"
+}
+
+// requestBaseURL returns the scheme and host the request was made to.
+func requestBaseURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// postImageURL returns the absolute URL of the post's first image when the
+// auto_detect_images setting is on, or "" otherwise or when the image
+// isn't an http(s) URL.
+func postImageURL(db *sql.DB, post *Post, baseURL string) string {
+	if value, _ := getSetting(db, "auto_detect_images"); value != "true" {
+		return ""
+	}
+	image := firstImageURL(post.Content)
+	if strings.HasPrefix(image, "/") {
+		image = baseURL + image
+	}
+	if !isHTTPURL(image) {
+		return ""
+	}
+	return image
+}
+
+// ogImageURL resolves the og:image for a post: its own override, then its
+// first content image, then the site-wide default. It returns "" when none
+// of them is set.
+func ogImageURL(db *sql.DB, post *Post, baseURL string) string {
+	if isHTTPURL(post.OGImage) {
+		return post.OGImage
+	}
+	if image := postImageURL(db, post, baseURL); image != "" {
+		return image
+	}
+	return getDefaultOGImage(db)
+}
+
+// imageEnclosure describes an image URL as an RSS enclosure, or returns nil
+// when the file type can't be told from its extension. The length is
+// unknown without fetching the file, so it is 0 as the spec allows.
+func imageEnclosure(imageURL string) *rssEnclosure {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return nil
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(u.Path)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil
+	}
+	return &rssEnclosure{URL: imageURL, Type: mimeType}
+}
+
+// parsePostMeta reads and validates the optional post fields from the edit form.
+func parsePostMeta(r *http.Request) (PostMeta, error) {
+	meta := PostMeta{
+		CanonicalURL: strings.TrimSpace(r.FormValue("canonical_url")),
+		NoIndex:      r.FormValue("noindex") == "true",
+		Language:     strings.TrimSpace(r.FormValue("language")),
+		OGImage:      strings.TrimSpace(r.FormValue("og_image")),
+		Excerpt:      strings.TrimSpace(r.FormValue("excerpt")),
+		Template:     r.FormValue("template"),
+		AdminNotes:   strings.TrimSpace(r.FormValue("admin_notes")),
+		Pinned:       r.FormValue("pinned") == "true",
+		ShowRelated:  r.FormValue("show_related") == "true",
+	}
+	pinUntil, err := parseDateTimeLocal(r.FormValue("pin_until"), "Pin until")
+	if err != nil {
+		return meta, err
+	}
+	meta.PinUntil = pinUntil
+	if meta.Template == detailTemplates[0] {
+		meta.Template = ""
+	}
+	if meta.Template != "" && !slices.Contains(detailTemplates, meta.Template) {
+		return meta, errors.New("Layout must be one of " + strings.Join(detailTemplates, ", "))
+	}
+	if meta.CanonicalURL != "" && !isHTTPURL(meta.CanonicalURL) {
+		return meta, errors.New("Canonical URL must be an http or https URL")
+	}
+	if meta.OGImage != "" && !isHTTPURL(meta.OGImage) {
+		return meta, errors.New("Preview image must be an http or https URL")
+	}
+	if meta.Language != "" && !languageRegex.MatchString(meta.Language) {
+		return meta, errors.New("Language must be a language code like en or pt-BR")
+	}
+	if v := strings.TrimSpace(r.FormValue("translation_of")); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			return meta, errors.New("Translation of must be a post ID")
+		}
+		meta.TranslationOf = id
+	}
+	return meta, nil
+}
+
+// minPostDate is the earliest date a post can be given.
+var minPostDate = time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parsePostDate reads the YYYY-MM-DD date from the edit form. It returns
+// the zero time when the field is empty or unchanged from current, so the
+// post keeps its exact timestamp; a new date keeps current's time of day.
+// Dates before minPostDate or after tomorrow are rejected.
+func parsePostDate(value string, current time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == current.UTC().Format("2006-01-02") {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("Date must look like 2024-01-15")
+	}
+	if date.Before(minPostDate) || date.After(time.Now().UTC().AddDate(0, 0, 1)) {
+		return time.Time{}, fmt.Errorf("Date must be between %s and today", minPostDate.Format("2006-01-02"))
+	}
+	clock := current.UTC()
+	return date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute + time.Duration(clock.Second())*time.Second), nil
+}
+
+// dateTimeLocalLayout is the format of datetime-local form fields.
+const dateTimeLocalLayout = "2006-01-02T15:04"
+
+// parseDateTimeLocal reads a datetime-local field from the post form, in
+// UTC. An empty field gives the zero time; label names the field in errors.
+func parseDateTimeLocal(value, label string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(dateTimeLocalLayout, value)
+	if err != nil {
+		return time.Time{}, errors.New(label + " must look like 2024-01-15T09:00")
+	}
+	return t, nil
+}
+
+// languageRegex loosely matches a BCP 47 language tag such as en or pt-BR.
+var languageRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// hreflangLink is a <link rel="alternate" hreflang> for a post's translation.
+type hreflangLink struct {
+	Language string
+	URL      string
+}
+
+// hreflangLinks returns the hreflang alternates for post: itself plus each
+// translation, skipping any without a language. It returns nil when there
+// is nothing to link.
+func (b *Blog) hreflangLinks(post *Post, baseURL string) ([]hreflangLink, error) {
+	if post.Language == "" {
+		return nil, nil
+	}
+	translations, err := b.posts.GetTranslations(post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []hreflangLink{{Language: post.Language, URL: baseURL + "/" + post.Slug}}
+	for _, t := range translations {
+		if t.Language != "" {
+			links = append(links, hreflangLink{Language: t.Language, URL: baseURL + "/" + t.Slug})
+		}
+	}
+	if len(links) == 1 {
+		return nil, nil
+	}
+	return links, nil
+}
+
+// feedLimit returns how many items a feed response should contain: the
+// ?limit= query parameter when valid, else feed_max_items, clamped to maxFeedItems.
+func (b *Blog) feedLimit(r *http.Request) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return min(n, maxFeedItems)
+	}
+	return getFeedMaxItems(b.db)
+}
+
+// displaySettingKeys are the settings every page's base template needs.
+var displaySettingKeys = []string{"theme", "font", "blog_name"}
+
+// allowFeedRequest counts a feed request from the client and logs clients
+// that go over the feed rate limit. When feed_rate_limit_block is set it
+// also answers them with a 429 and returns false.
+func (b *Blog) allowFeedRequest(w http.ResponseWriter, r *http.Request) bool {
+	limit := getFeedRateLimit(b.db)
+	if limit == 0 {
+		return true
+	}
+
+	ip := clientIP(r)
+	count := b.feeds.record(ip)
+	if count <= limit {
+		return true
+	}
+	if count == limit+1 {
+		log.Printf("feed client %s exceeded %d requests per %v (%s)", ip, limit, feedRateWindow, r.UserAgent())
+	}
+	if value, _ := getSetting(b.db, "feed_rate_limit_block"); value != "true" {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(feedRateWindow.Seconds())))
+	http.Error(w, "Too many feed requests, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+// feedFreshness returns when the newest of a feed's posts last changed and
+// an ETag identifying exactly that set of posts, so every feed format
+// validates the same way. A feed cache purge counts as a change to every
+// feed, so generation is hashed in and purged moves modified forward.
+func feedFreshness(posts []Post, generation uint64, purged time.Time) (time.Time, string) {
+	modified := purged
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d;", generation)
+	for _, post := range posts {
+		changed := post.CreatedAt
+		if post.UpdatedAt.After(changed) {
+			changed = post.UpdatedAt
+		}
+		if changed.After(modified) {
+			modified = changed
+		}
+		fmt.Fprintf(hash, "%d:%d:%d;", post.ID, post.CreatedAt.UnixNano(), post.UpdatedAt.UnixNano())
+	}
+	return modified, fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// feedNotModified sets the ETag and Last-Modified headers for a feed of
+// posts and answers 304 Not Modified when the client's copy is current.
+// If-None-Match takes precedence over If-Modified-Since.
+func feedNotModified(w http.ResponseWriter, r *http.Request, db *sql.DB, posts []Post) bool {
+	generation, purged := feedCacheFor(db).version()
+	modified, etag := feedFreshness(posts, generation, purged)
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
 }
 
 func (b *Blog) getDisplaySettings() (theme, font, blogName string) {
-	theme, _ = getSetting(b.db, "theme")
-	font, _ = getSetting(b.db, "font")
-	blogName = getBlogName(b.db)
-	return
+	settings, _ := getSettings(b.db, displaySettingKeys...)
+	return settings["theme"], settings["font"], blogNameOrDefault(settings["blog_name"])
+}
+
+// postsPerPage is how many published posts each home page lists.
+const postsPerPage = 20
+
+// pageNumber parses the ?page= query parameter, defaulting to 1.
+func pageNumber(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// wantsFeed reports whether the request's Accept header explicitly asks
+// for an RSS or Atom feed rather than HTML.
+func wantsFeed(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/html") {
+		return false
+	}
+	return strings.Contains(accept, "application/rss+xml") || strings.Contains(accept, "application/atom+xml")
+}
+
+// bucketPosts splits posts, keeping their order, into those visitors can
+// see, those published but scheduled for later, and drafts.
+func bucketPosts(posts []Post) (published, scheduled, drafts []Post) {
+	for _, p := range posts {
+		switch {
+		case p.IsDraft():
+			drafts = append(drafts, p)
+		case p.IsScheduled():
+			scheduled = append(scheduled, p)
+		default:
+			published = append(published, p)
+		}
+	}
+	return published, scheduled, drafts
+}
+
+// newestPost returns the index of the most recently created of posts, which
+// isn't necessarily the first since pinned posts sort ahead of the rest.
+// posts must not be empty.
+func newestPost(posts []Post) int {
+	newest := 0
+	for i, p := range posts {
+		if p.CreatedAt.After(posts[newest].CreatedAt) {
+			newest = i
+		}
+	}
+	return newest
 }
 
 func (b *Blog) Home(w http.ResponseWriter, r *http.Request) {
+	b.announceDuePosts(r)
+
+	// Optionally serve the feed to clients that ask for one at /
+	if value, _ := getSetting(b.db, "negotiate_home_feed"); value == "true" {
+		w.Header().Add("Vary", "Accept")
+		if wantsFeed(r) {
+			w.Header().Set("Content-Location", "/feed")
+			b.Feed(w, r)
+			return
+		}
+	}
+
 	isAuth := b.isAuthenticated(r)
 
-	var posts, drafts []Post
+	var posts, scheduled, drafts []Post
 	var err error
 
 	if isAuth {
-		allPosts, err := getPosts(b.db)
+		allPosts, err := b.posts.GetPosts()
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			b.serverError(w, r)
+			return
+		}
+		posts, scheduled, drafts = bucketPosts(allPosts)
+	} else {
+		posts, err = b.posts.GetPublishedPosts()
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+	}
+
+	publishedCount, draftCount := len(posts), len(drafts)
+
+	page := pageNumber(r)
+	lastPage := max(1, (len(posts)+postsPerPage-1)/postsPerPage)
+	if page > lastPage {
+		b.NotFound(w, r)
+		return
+	}
+	posts = posts[(page-1)*postsPerPage : min(len(posts), page*postsPerPage)]
+
+	var robots, prevURL, nextURL string
+	if page > 1 {
+		// Later pages are near-duplicates of the archive; keep them out of the index
+		robots = "noindex,follow"
+		scheduled, drafts = nil, nil
+		prevURL = "/"
+		if page > 2 {
+			prevURL = fmt.Sprintf("/?page=%d", page-1)
+		}
+	}
+	if page < lastPage {
+		nextURL = fmt.Sprintf("/?page=%d", page+1)
+	}
+
+	// With the featured layout, the newest post on the first page is shown
+	// in full above the list of the rest, pinned posts included
+	var featured *Post
+	if page == 1 && len(posts) > 0 && isHomeFeatured(b.db) {
+		i := newestPost(posts)
+		newest := posts[i]
+		featured = &newest
+		posts = slices.Delete(posts, i, i+1)
+	}
+
+	// Fetch the intro along with the display settings in one query
+	settings, err := getSettings(b.db, append([]string{"intro"}, displaySettingKeys...)...)
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	intro := settings["intro"]
+	theme, font, blogName := settings["theme"], settings["font"], blogNameOrDefault(settings["blog_name"])
+
+	data := map[string]any{
+		"Title":             "Home",
+		"Featured":          featured,
+		"Posts":             posts,
+		"Scheduled":         scheduled,
+		"Drafts":            drafts,
+		"Robots":            robots,
+		"PrevURL":           prevURL,
+		"NextURL":           nextURL,
+		"ExcerptMode":       getHomeExcerptMode(b.db),
+		"ExcerptLength":     getHomeExcerptLength(b.db),
+		"ExcerptParagraphs": getHomeExcerptParagraphs(b.db),
+		"Intro":             intro,
+		"Description":       truncate(plainText(intro), 160),
+		"IsAuthenticated":   isAuth,
+		"CSRFToken":         ensureCSRFToken(w, r),
+		"Theme":             theme,
+		"Font":              font,
+		"BlogName":          blogName,
+	}
+	if isAuth {
+		data["PublishedCount"] = publishedCount
+		data["DraftCount"] = draftCount
+	}
+
+	b.render(w, "home.html", data)
+}
+
+// searchSuggestionCount is how many recent posts an empty search suggests.
+const searchSuggestionCount = 5
+
+func (b *Blog) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	isAuthenticated := b.isAuthenticated(r)
+	sort := r.URL.Query().Get("sort")
+	if _, ok := searchSorts[sort]; !ok {
+		sort = defaultSearchSort
+	}
+
+	var results, suggestions []Post
+	if query != "" {
+		var err error
+		results, err = b.posts.Search(query, sort, isAuthenticated)
+		if err != nil {
+			log.Printf("searching posts for %q: %v", query, err)
+			b.serverError(w, r)
 			return
 		}
-		for _, p := range allPosts {
-			if p.Published {
-				posts = append(posts, p)
-			} else {
-				drafts = append(drafts, p)
+
+		if len(results) == 0 {
+			recent, err := b.posts.GetPublishedPosts()
+			if err != nil {
+				b.serverError(w, r)
+				return
 			}
+			suggestions = recent[:min(len(recent), searchSuggestionCount)]
 		}
-	} else {
-		posts, err = getPublishedPosts(b.db)
+	}
+
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":           "Search",
+		"Query":           query,
+		"Sort":            sort,
+		"Posts":           results,
+		"Suggestions":     suggestions,
+		"IsAuthenticated": isAuthenticated,
+		"CSRFToken":       ensureCSRFToken(w, r),
+		"Theme":           theme,
+		"Font":            font,
+		"BlogName":        blogName,
+	}
+
+	b.render(w, "search.html", data)
+}
+
+// Tag lists the published posts filed under a tag.
+func (b *Blog) Tag(w http.ResponseWriter, r *http.Request) {
+	tag, err := b.posts.GetTag(r.PathValue("slug"))
+	if err != nil {
+		log.Printf("fetching tag: %v", err)
+		b.serverError(w, r)
+		return
+	}
+	if tag == nil {
+		b.NotFound(w, r)
+		return
+	}
+
+	posts, err := b.posts.GetByTag(tag.Slug, false)
+	if err != nil {
+		log.Printf("fetching posts tagged %q: %v", tag.Slug, err)
+		b.serverError(w, r)
+		return
+	}
+
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":           "Tagged " + tag.Name,
+		"Tag":             tag,
+		"Tags":            []Tag{*tag},
+		"Posts":           posts,
+		"FeedURL":         "/tag/" + tag.Slug + "/feed",
+		"IsAuthenticated": b.isAuthenticated(r),
+		"CSRFToken":       ensureCSRFToken(w, r),
+		"Theme":           theme,
+		"Font":            font,
+		"BlogName":        blogName,
+	}
+
+	b.render(w, "tag.html", data)
+}
+
+// Tags lists published posts filtered by several tags, given as repeated
+// t parameters (/tags?t=go&t=web). Posts must have all of the tags unless
+// match=any is given. Unknown tags are kept in the filter, so matching all
+// of them finds nothing; with no tags at all the page lists no posts.
+func (b *Blog) Tags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	slugs := query["t"]
+	matchAll := query.Get("match") != "any"
+
+	var tags []Tag
+	for _, slug := range slugs {
+		tag, err := b.posts.GetTag(slug)
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("fetching tag: %v", err)
+			b.serverError(w, r)
 			return
 		}
+		if tag == nil {
+			tag = &Tag{Name: slug, Slug: slug}
+		}
+		tags = append(tags, *tag)
 	}
 
-	intro, err := getSetting(b.db, "intro")
+	posts, err := b.posts.GetByTags(slugs, matchAll)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("fetching posts tagged %q: %v", slugs, err)
+		b.serverError(w, r)
 		return
 	}
 
+	joiner := "and"
+	if !matchAll {
+		joiner = "or"
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+
 	theme, font, blogName := b.getDisplaySettings()
 	data := map[string]any{
-		"Title":           "Home",
+		"Title":           "Tagged " + strings.Join(names, " "+joiner+" "),
+		"Tags":            tags,
+		"Joiner":          joiner,
 		"Posts":           posts,
-		"Drafts":          drafts,
-		"Intro":           intro,
-		"Description":     truncate(intro, 160),
-		"IsAuthenticated": isAuth,
+		"IsAuthenticated": b.isAuthenticated(r),
 		"CSRFToken":       ensureCSRFToken(w, r),
 		"Theme":           theme,
 		"Font":            font,
 		"BlogName":        blogName,
 	}
 
-	b.render(w, "home.html", data)
+	b.render(w, "tag.html", data)
 }
 
-// LegacyPostRedirect redirects old /post/{slug} URLs to /{slug}
+// LegacyPostRedirect redirects old /post/{slug} URLs to /{slug}. A numeric
+// segment is a post ID from before slugs existed, and redirects to that
+// post's current slug instead.
 func (b *Blog) LegacyPostRedirect(w http.ResponseWriter, r *http.Request) {
 	slug := r.PathValue("slug")
+
+	if id, err := strconv.Atoi(slug); err == nil {
+		post, err := b.posts.GetByID(id)
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+		// Don't reveal draft or scheduled slugs to visitors
+		if post == nil || (!post.IsPublic() && !b.isAuthenticated(r)) {
+			b.NotFound(w, r)
+			return
+		}
+		slug = post.Slug
+	}
+
 	http.Redirect(w, r, "/"+url.PathEscape(slug), http.StatusMovedPermanently)
 }
 
+// redirectOldSlug permanently redirects a slug a post was renamed from to
+// the post's current slug, or renders the 404 page if there is no such post.
+func (b *Blog) redirectOldSlug(w http.ResponseWriter, r *http.Request, slug string) {
+	post, err := b.posts.GetByOldSlug(slug)
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	// Don't reveal draft or scheduled slugs to visitors
+	if post == nil || (!post.IsPublic() && !b.isAuthenticated(r)) {
+		b.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, "/"+url.PathEscape(post.Slug), http.StatusMovedPermanently)
+}
+
+// relatedPostCount is how many related posts the detail page lists.
+const relatedPostCount = 3
+
 func (b *Blog) Detail(w http.ResponseWriter, r *http.Request) {
+	b.announceDuePosts(r)
+
 	slug := r.PathValue("slug")
 	if slug == "" {
-		http.NotFound(w, r)
+		b.NotFound(w, r)
+		return
+	}
+
+	post, err := b.posts.GetBySlug(slug)
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	if post == nil {
+		b.redirectOldSlug(w, r, slug)
+		return
+	}
+
+	isAuth := b.isAuthenticated(r)
+
+	if !post.IsPublic() && !isAuth {
+		b.NotFound(w, r)
+		return
+	}
+
+	canonicalURL := post.CanonicalURL
+	if canonicalURL == "" {
+		canonicalURL = requestBaseURL(r) + "/" + post.Slug
+	}
+
+	alternates, err := b.hreflangLinks(post, requestBaseURL(r))
+	if err != nil {
+		log.Printf("fetching translations of post %d: %v", post.ID, err)
+		b.serverError(w, r)
 		return
 	}
 
-	post, err := getPostBySlug(b.db, slug)
+	tags, err := b.posts.GetTags(post.ID)
+	if err != nil {
+		log.Printf("fetching tags of post %d: %v", post.ID, err)
+		b.serverError(w, r)
+		return
+	}
+
+	var related []Post
+	if post.ShowRelated {
+		related, err = b.posts.GetRelated(post.ID, relatedPostCount)
+		if err != nil {
+			log.Printf("fetching posts related to post %d: %v", post.ID, err)
+			b.serverError(w, r)
+			return
+		}
+	}
+
+	prev, next, err := b.posts.GetAdjacent(*post, isAuth)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("fetching posts next to post %d: %v", post.ID, err)
+		b.serverError(w, r)
 		return
 	}
-	if post == nil {
-		http.NotFound(w, r)
-		return
+
+	var robots string
+	if post.NoIndex {
+		robots = "noindex"
+		w.Header().Set("X-Robots-Tag", "noindex")
 	}
 
-	isAuth := b.isAuthenticated(r)
+	theme, font, blogName := b.getDisplaySettings()
 
-	if !post.Published && !isAuth {
-		http.NotFound(w, r)
-		return
+	// Drafts and scheduled posts aren't public, so don't describe them to
+	// search engines
+	var jsonLD *articleJSONLD
+	if post.IsPublic() {
+		jsonLD = newArticleJSONLD(post, blogName, canonicalURL)
 	}
 
-	theme, font, blogName := b.getDisplaySettings()
 	data := map[string]any{
 		"Title":           post.Title,
 		"Post":            post,
-		"Description":     truncate(post.Content, 160),
+		"Tags":            tags,
+		"Related":         related,
+		"PrevPost":        prev,
+		"NextPost":        next,
+		"CanonicalURL":    canonicalURL,
+		"Alternates":      alternates,
+		"Robots":          robots,
+		"OGImage":         ogImageURL(b.db, post, requestBaseURL(r)),
+		"JSONLD":          jsonLD,
+		"IsDraftPreview":  !post.Published,
+		"IsScheduled":     post.IsScheduled(),
+		"DateLabel":       getDateLabel(b.db),
+		"Description":     post.Summary(160),
 		"IsAuthenticated": isAuth,
 		"CSRFToken":       ensureCSRFToken(w, r),
 		"Theme":           theme,
@@ -145,7 +986,7 @@ func (b *Blog) Detail(w http.ResponseWriter, r *http.Request) {
 		"BlogName":        blogName,
 	}
 
-	b.render(w, "detail.html", data)
+	b.render(w, post.DetailTemplate(), data)
 }
 
 func (b *Blog) Create(w http.ResponseWriter, r *http.Request) {
@@ -169,6 +1010,7 @@ func (b *Blog) Create(w http.ResponseWriter, r *http.Request) {
 		}
 
 		title := r.FormValue("title")
+		slug := r.FormValue("slug")
 		content := r.FormValue("content")
 		action := r.FormValue("action")
 
@@ -179,12 +1021,73 @@ func (b *Blog) Create(w http.ResponseWriter, r *http.Request) {
 
 		published := action == "publish"
 
-		slug, err := createPost(b.db, title, content, published)
+		publishAt, err := parseDateTimeLocal(r.FormValue("publish_at"), "Publish at")
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Guard against double submits unless the author insists
+		if published && r.FormValue("force") == "" {
+			existing, err := b.posts.FindRecentDuplicate(title, content)
+			if err != nil {
+				b.serverError(w, r)
+				return
+			}
+			if existing != nil {
+				http.Redirect(w, r, "/"+url.PathEscape(existing.Slug), http.StatusSeeOther)
+				return
+			}
+		}
+
+		// A scheduled post starts as a draft so it's never briefly public
+		scheduled := published && publishAt.After(time.Now())
+		slug, err = b.posts.Create(title, slug, content, published && !scheduled)
+		if err != nil {
+			b.serverError(w, r)
 			return
 		}
 
+		tags := parseTags(r.FormValue("tags"))
+		excerpt := strings.TrimSpace(r.FormValue("excerpt"))
+		if len(tags) > 0 || !publishAt.IsZero() || excerpt != "" {
+			post, err := b.posts.GetBySlug(slug)
+			if err != nil || post == nil {
+				b.serverError(w, r)
+				return
+			}
+			if !publishAt.IsZero() {
+				slug, err = b.posts.Update(post.ID, title, slug, content, published, PostDates{PublishAt: publishAt}, currentUserID(r))
+				if err != nil {
+					b.serverError(w, r)
+					return
+				}
+			}
+			if scheduled {
+				if err := setAnnouncePending(b.db, post.ID, true); err != nil {
+					b.serverError(w, r)
+					return
+				}
+			}
+			if excerpt != "" {
+				if err := b.posts.UpdateMeta(post.ID, PostMeta{Excerpt: excerpt, ShowRelated: true}); err != nil {
+					b.serverError(w, r)
+					return
+				}
+			}
+			if len(tags) > 0 {
+				if err := b.posts.SetTags(post.ID, tags); err != nil {
+					b.serverError(w, r)
+					return
+				}
+			}
+		}
+
+		// Scheduled posts are announced by announceDuePosts once they're live
+		if published && !scheduled {
+			b.announcePost(title, requestBaseURL(r)+"/"+slug)
+		}
+
 		http.Redirect(w, r, "/"+url.PathEscape(slug), http.StatusSeeOther)
 	}
 }
@@ -197,20 +1100,34 @@ func (b *Blog) Edit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodGet {
-		post, err := getPostByID(b.db, id)
+		post, err := b.posts.GetByID(id)
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			b.serverError(w, r)
 			return
 		}
 		if post == nil {
-			http.NotFound(w, r)
+			b.NotFound(w, r)
+			return
+		}
+
+		tags, err := b.posts.GetTags(post.ID)
+		if err != nil {
+			b.serverError(w, r)
 			return
 		}
+		tagNames := make([]string, len(tags))
+		for i, tag := range tags {
+			tagNames[i] = tag.Name
+		}
 
 		theme, font, blogName := b.getDisplaySettings()
 		data := map[string]any{
 			"Title":           fmt.Sprintf("Editing %q", post.Title),
 			"Post":            post,
+			"Layouts":         detailTemplates,
+			"Tags":            strings.Join(tagNames, ", "),
+			"Warnings":        validateMarkdown(post.Content),
+			"Saved":           r.URL.Query().Get("saved") == "1",
 			"IsAuthenticated": true,
 			"CSRFToken":       ensureCSRFToken(w, r),
 			"Theme":           theme,
@@ -221,142 +1138,517 @@ func (b *Blog) Edit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		if !parseFormWithCSRF(w, r) {
-			return
-		}
-
-		title := r.FormValue("title")
-		content := r.FormValue("content")
-		action := r.FormValue("action")
-
-		if title == "" || content == "" {
-			http.Error(w, "Title and content are required", http.StatusBadRequest)
-			return
-		}
-
-		published := action == "publish"
+	if r.Method == http.MethodPost {
+		if !parseFormWithCSRF(w, r) {
+			return
+		}
+
+		title := r.FormValue("title")
+		slug := r.FormValue("slug")
+		content := r.FormValue("content")
+		action := r.FormValue("action")
+
+		if title == "" || content == "" {
+			http.Error(w, "Title and content are required", http.StatusBadRequest)
+			return
+		}
+
+		meta, err := parsePostMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if meta.TranslationOf == id {
+			http.Error(w, "A post can't be a translation of itself", http.StatusBadRequest)
+			return
+		}
+
+		published := action == "publish"
+
+		before, err := b.posts.GetByID(id)
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+		if before == nil {
+			b.NotFound(w, r)
+			return
+		}
+
+		created, err := parsePostDate(r.FormValue("date"), before.CreatedAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		publishAt, err := parseDateTimeLocal(r.FormValue("publish_at"), "Publish at")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dates := PostDates{Created: created, PublishAt: publishAt}
+
+		var newSlug string
+		if version := r.FormValue("updated_at"); version != "" {
+			newSlug, err = b.posts.UpdateIfUnchanged(id, version, title, slug, content, published, dates, currentUserID(r))
+		} else {
+			newSlug, err = b.posts.Update(id, title, slug, content, published, dates, currentUserID(r))
+		}
+		if errors.Is(err, errEditConflict) {
+			http.Error(w, "This post was changed somewhere else after you opened it. Reload the editor to get the latest version, then reapply your changes.", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+		if err := b.posts.UpdateMeta(id, meta); err != nil {
+			b.serverError(w, r)
+			return
+		}
+		if err := b.posts.SetTags(id, parseTags(r.FormValue("tags"))); err != nil {
+			b.serverError(w, r)
+			return
+		}
+
+		// Announce only when a draft goes live, not on every edit. A post
+		// scheduled for later is left to announceDuePosts, and one taken
+		// back to draft no longer has an announcement pending.
+		switch {
+		case published && !before.Published && publishAt.After(time.Now()):
+			err = setAnnouncePending(b.db, id, true)
+		case published && !before.Published:
+			b.announcePost(title, requestBaseURL(r)+"/"+newSlug)
+		case !published:
+			err = setAnnouncePending(b.db, id, false)
+		}
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+
+		// Return to the editor so the author sees any markdown warnings
+		if len(validateMarkdown(content)) > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/edit/%d?saved=1", id), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/"+url.PathEscape(newSlug), http.StatusSeeOther)
+	}
+}
+
+func (b *Blog) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		post, err := b.posts.GetByID(id)
+		if err != nil {
+			b.serverError(w, r)
+			return
+		}
+		if post == nil {
+			b.NotFound(w, r)
+			return
+		}
+
+		deleteToken, err := createDeleteToken(b.db, post.ID)
+		if err != nil {
+			log.Printf("creating delete token: %v", err)
+			b.serverError(w, r)
+			return
+		}
+
+		theme, font, blogName := b.getDisplaySettings()
+		data := map[string]any{
+			"Title":           fmt.Sprintf("Deleting %q", post.Title),
+			"Post":            post,
+			"DeleteToken":     deleteToken,
+			"IsAuthenticated": true,
+			"CSRFToken":       ensureCSRFToken(w, r),
+			"Theme":           theme,
+			"Font":            font,
+			"BlogName":        blogName,
+		}
+		b.render(w, "delete.html", data)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !parseFormWithCSRF(w, r) {
+			return
+		}
+
+		ok, err := consumeDeleteToken(b.db, r.FormValue("delete_token"), id)
+		if err != nil {
+			log.Printf("checking delete token: %v", err)
+			b.serverError(w, r)
+			return
+		}
+		if !ok {
+			http.Error(w, "This delete confirmation has expired or was already used. Go back and confirm again.", http.StatusForbidden)
+			return
+		}
+
+		if err := b.posts.Delete(id); err != nil {
+			b.serverError(w, r)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// Trash lists deleted posts on GET. POSTs to /trash/{id}/restore and
+// /trash/{id}/purge take a post back out of the trash or remove it for good.
+func (b *Blog) Trash(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		posts, err := b.posts.GetDeleted()
+		if err != nil {
+			log.Printf("fetching deleted posts: %v", err)
+			b.serverError(w, r)
+			return
+		}
+
+		theme, font, blogName := b.getDisplaySettings()
+		data := map[string]any{
+			"Title":           "Trash",
+			"Posts":           posts,
+			"IsAuthenticated": true,
+			"CSRFToken":       ensureCSRFToken(w, r),
+			"Theme":           theme,
+			"Font":            font,
+			"BlogName":        blogName,
+		}
+		b.render(w, "trash.html", data)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	if !parseFormWithCSRF(w, r) {
+		return
+	}
+
+	var action func(int) error
+	switch r.PathValue("action") {
+	case "restore":
+		action = b.posts.Restore
+	case "purge":
+		action = b.posts.Purge
+	default:
+		b.NotFound(w, r)
+		return
+	}
+	if err := action(id); err != nil {
+		log.Printf("%s post %d: %v", r.PathValue("action"), id, err)
+		b.serverError(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// renderSettings renders the Settings page with the given status, showing
+// passwordErr above the change password form when set.
+func (b *Blog) renderSettings(w http.ResponseWriter, r *http.Request, status int, passwordErr string) {
+	intro, err := getSetting(b.db, "intro")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	loginMessage, err := getSetting(b.db, "login_message")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	prefixNumeric, err := getSetting(b.db, "prefix_numeric_slugs")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	dashboardOnLogin, err := getSetting(b.db, "dashboard_on_login")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	feedRateLimitBlock, err := getSetting(b.db, "feed_rate_limit_block")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	negotiateHomeFeed, err := getSetting(b.db, "negotiate_home_feed")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	slugDatePrefix, err := getSetting(b.db, "slug_date_prefix")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	reuseDeletedSlugs, err := getSetting(b.db, "reuse_deleted_slugs")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+	autoDetectImages, err := getSetting(b.db, "auto_detect_images")
+	if err != nil {
+		b.serverError(w, r)
+		return
+	}
+
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":              "Settings",
+		"Intro":              intro,
+		"LoginMessage":       loginMessage,
+		"MaintenanceMode":    isMaintenanceMode(b.db),
+		"DeleteArchive":      isDeleteArchiveEnabled(b.db),
+		"DashboardOnLogin":   dashboardOnLogin == "true",
+		"FeedMaxItems":       getFeedMaxItems(b.db),
+		"FeedRateLimit":      getFeedRateLimit(b.db),
+		"FeedRateLimitBlock": feedRateLimitBlock == "true",
+		"FeedImageURL":       getFeedImageURL(b.db),
+		"DefaultOGImage":     getDefaultOGImage(b.db),
+		"AutoDetectImages":   autoDetectImages == "true",
+		"HomeFeatured":       isHomeFeatured(b.db),
+		"NegotiateHomeFeed":  negotiateHomeFeed == "true",
+		"AuthorEmail":        getAuthorEmail(b.db),
+		"AnnounceWebhook":    getAnnounceWebhook(b.db),
+		"DateLabel":          getDateLabel(b.db),
+		"ExcerptMode":        getHomeExcerptMode(b.db),
+		"ExcerptLength":      getHomeExcerptLength(b.db),
+		"ExcerptParagraphs":  getHomeExcerptParagraphs(b.db),
+		"PrefixNumeric":      prefixNumeric == "true",
+		"SlugDatePrefix":     slugDatePrefix == "true",
+		"SlugExtraChars":     getSlugExtraChars(b.db),
+		"ReuseDeletedSlugs":  reuseDeletedSlugs == "true",
+		"PasswordError":      passwordErr,
+		"CachePurged":        r.URL.Query().Get("purged") != "",
+		"Sitemap":            getSitemapHints(b.db),
+		"ChangeFreqs":        sitemapChangeFreqs,
+		"IsAuthenticated":    true,
+		"CSRFToken":          ensureCSRFToken(w, r),
+		"Theme":              theme,
+		"Font":               font,
+		"BlogName":           blogName,
+	}
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	b.render(w, "settings.html", data)
+}
+
+func (b *Blog) Settings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		b.renderSettings(w, r, http.StatusOK, "")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !parseFormWithCSRF(w, r) {
+			return
+		}
+
+		for _, key := range settingsFormKeys {
+			if err := setSetting(b.db, key, r.FormValue(key)); err != nil {
+				b.serverError(w, r)
+				return
+			}
+		}
+		feedCacheFor(b.db).purge()
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// PurgeCache empties the feed and settings caches, for when a change should
+// show up in feeds before the cache expires on its own.
+func (b *Blog) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	if !parseFormWithCSRF(w, r) {
+		return
+	}
+
+	feedCacheFor(b.db).purge()
+	settingsCacheFor(b.db).invalidate()
+
+	http.Redirect(w, r, "/settings?purged=1", http.StatusSeeOther)
+}
+
+const (
+	// minPasswordLength is the shortest password ChangePassword accepts.
+	minPasswordLength = 8
+	// maxPasswordLength is the longest, in bytes: bcrypt refuses more.
+	maxPasswordLength = 72
+)
+
+// ChangePassword replaces the admin password after checking the current one.
+func (b *Blog) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if !parseFormWithCSRF(w, r) {
+		return
+	}
+
+	// Wrong current passwords count against the login limit, so a hijacked
+	// session can't guess the password any faster than the login form
+	ip := clientIP(r)
+	if !b.logins.allow(ip, maxLoginFailures) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(loginFailureWindow.Seconds())))
+		b.renderSettings(w, r, http.StatusTooManyRequests, "Too many failed attempts. Please try again later.")
+		return
+	}
+	if !checkPassword(adminPasswordHash(b.db), r.FormValue("current_password")) {
+		b.logins.record(ip)
+		b.renderSettings(w, r, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+	b.logins.reset(ip)
+
+	newPassword := r.FormValue("new_password")
+	switch {
+	case len(newPassword) < minPasswordLength:
+		b.renderSettings(w, r, http.StatusBadRequest, fmt.Sprintf("New password must be at least %d characters", minPasswordLength))
+		return
+	case len(newPassword) > maxPasswordLength:
+		b.renderSettings(w, r, http.StatusBadRequest, fmt.Sprintf("New password must be at most %d bytes", maxPasswordLength))
+		return
+	case newPassword != r.FormValue("confirm_password"):
+		b.renderSettings(w, r, http.StatusBadRequest, "New passwords don't match")
+		return
+	}
+
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		log.Printf("changing password: %v", err)
+		b.serverError(w, r)
+		return
+	}
+	if err := setSetting(b.db, "admin_password_hash", hash); err != nil {
+		b.serverError(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
 
-		newSlug, err := updatePost(b.db, id, title, content, published)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+// shortcutTargets maps /go/{name} shortcuts to the admin pages they open.
+var shortcutTargets = map[string]string{
+	"new":       "/new",
+	"dashboard": "/dashboard",
+	"settings":  "/settings",
+	"export":    "/export",
+}
 
-		http.Redirect(w, r, "/"+url.PathEscape(newSlug), http.StatusSeeOther)
+// Shortcut redirects stable /go/{name} URLs, meant for bookmarks and
+// browser keywords, to the admin page they stand for.
+func (b *Blog) Shortcut(w http.ResponseWriter, r *http.Request) {
+	target, ok := shortcutTargets[r.PathValue("name")]
+	if !ok {
+		b.NotFound(w, r)
+		return
 	}
+	http.Redirect(w, r, target, http.StatusFound)
 }
 
-func (b *Blog) Delete(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.PathValue("id"))
+// dashboardDraftCount is how many of the most recent drafts the dashboard lists.
+const dashboardDraftCount = 5
+
+// Dashboard summarizes the blog for the admin: post and draft counts, the
+// most recent drafts, and links to common tasks.
+func (b *Blog) Dashboard(w http.ResponseWriter, r *http.Request) {
+	posts, err := b.posts.GetPosts()
 	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		log.Printf("fetching posts for dashboard: %v", err)
+		b.serverError(w, r)
 		return
 	}
 
-	if r.Method == http.MethodGet {
-		post, err := getPostByID(b.db, id)
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if post == nil {
-			http.NotFound(w, r)
-			return
-		}
+	published, scheduled, drafts := bucketPosts(posts)
 
-		theme, font, blogName := b.getDisplaySettings()
-		data := map[string]any{
-			"Title":           fmt.Sprintf("Deleting %q", post.Title),
-			"Post":            post,
-			"IsAuthenticated": true,
-			"CSRFToken":       ensureCSRFToken(w, r),
-			"Theme":           theme,
-			"Font":            font,
-			"BlogName":        blogName,
-		}
-		b.render(w, "delete.html", data)
-		return
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":           "Dashboard",
+		"PublishedCount":  len(published),
+		"ScheduledCount":  len(scheduled),
+		"DraftCount":      len(drafts),
+		"Scheduled":       scheduled,
+		"Drafts":          drafts[:min(len(drafts), dashboardDraftCount)],
+		"IsAuthenticated": true,
+		"CSRFToken":       ensureCSRFToken(w, r),
+		"Theme":           theme,
+		"Font":            font,
+		"BlogName":        blogName,
 	}
+	b.render(w, "dashboard.html", data)
+}
 
-	if r.Method == http.MethodPost {
-		if !parseFormWithCSRF(w, r) {
-			return
-		}
-
-		if err := deletePost(b.db, id); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+// ExportSettings downloads the blog's settings as JSON for backup.
+func (b *Blog) ExportSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := exportSettings(b.db)
+	if err != nil {
+		log.Printf("exporting settings: %v", err)
+		b.serverError(w, r)
+		return
+	}
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="settings.json"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(settings); err != nil {
+		log.Printf("encoding settings: %v", err)
 	}
 }
 
-func (b *Blog) Settings(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		intro, err := getSetting(b.db, "intro")
-		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		theme, font, blogName := b.getDisplaySettings()
-		data := map[string]any{
-			"Title":           "Settings",
-			"Intro":           intro,
-			"IsAuthenticated": true,
-			"CSRFToken":       ensureCSRFToken(w, r),
-			"Theme":           theme,
-			"Font":            font,
-			"BlogName":        blogName,
-		}
-		b.render(w, "settings.html", data)
+// ImportSettings restores settings from JSON pasted into the settings
+// form, as produced by ExportSettings.
+func (b *Blog) ImportSettings(w http.ResponseWriter, r *http.Request) {
+	if !parseFormWithCSRF(w, r) {
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		if !parseFormWithCSRF(w, r) {
-			return
-		}
-
-		intro := r.FormValue("intro")
-		theme := r.FormValue("theme")
-		font := r.FormValue("font")
-		blogName := r.FormValue("blog_name")
+	var settings map[string]string
+	if err := json.Unmarshal([]byte(r.FormValue("settings")), &settings); err != nil {
+		http.Error(w, "Settings must be a JSON object of strings", http.StatusBadRequest)
+		return
+	}
+	if err := importSettings(b.db, settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	feedCacheFor(b.db).purge()
 
-		if err := setSetting(b.db, "intro", intro); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if err := setSetting(b.db, "theme", theme); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if err := setSetting(b.db, "font", font); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		if err := setSetting(b.db, "blog_name", blogName); err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+// renderLogin renders the login page, branded with the blog name and the
+// optional login_message setting.
+func (b *Blog) renderLogin(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	loginMessage, _ := getSetting(b.db, "login_message")
+	theme, font, blogName := b.getDisplaySettings()
+	data := map[string]any{
+		"Title":        "Login",
+		"Heading":      blogName,
+		"LoginMessage": loginMessage,
+		"Error":        errMsg,
+		"CSRFToken":    ensureCSRFToken(w, r),
+		"Theme":        theme,
+		"Font":         font,
+		"BlogName":     blogName,
+	}
+	if status != http.StatusOK {
+		w.WriteHeader(status)
 	}
+	b.render(w, "admin.html", data)
 }
 
 func (b *Blog) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		theme, font, blogName := b.getDisplaySettings()
-		data := map[string]any{
-			"Title":     "Login",
-			"CSRFToken": ensureCSRFToken(w, r),
-			"Theme":     theme,
-			"Font":      font,
-			"BlogName":  blogName,
-		}
-		b.render(w, "admin.html", data)
+		b.renderLogin(w, r, http.StatusOK, "")
 		return
 	}
 
@@ -365,41 +1657,41 @@ func (b *Blog) Login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		ip := clientIP(r)
+		if !b.logins.allow(ip, maxLoginFailures) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(loginFailureWindow.Seconds())))
+			b.renderLogin(w, r, http.StatusTooManyRequests, "Too many failed attempts. Please try again later.")
+			return
+		}
+
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		if subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) != 1 || !checkPassword(adminPassword, password) {
-			theme, font, blogName := b.getDisplaySettings()
-			data := map[string]any{
-				"Title":     "Login",
-				"Error":     "Invalid username or password",
-				"CSRFToken": getCSRFToken(r),
-				"Theme":     theme,
-				"Font":      font,
-				"BlogName":  blogName,
-			}
-			w.WriteHeader(http.StatusUnauthorized)
-			b.render(w, "admin.html", data)
+		if subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) != 1 || !checkPassword(adminPasswordHash(b.db), password) {
+			b.logins.record(ip)
+			b.renderLogin(w, r, http.StatusUnauthorized, "Invalid username or password")
 			return
 		}
+		b.logins.reset(ip)
+
+		duration := sessionDuration
+		if r.FormValue("remember") == "true" {
+			duration = rememberDuration
+		}
 
-		token, err := createSession(b.db, 1) // userID 1 for admin
+		token, err := createSessionWithDuration(b.db, 1, duration) // userID 1 for admin
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			b.serverError(w, r)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     sessionCookieName,
-			Value:    token,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   secureCookies,
-			SameSite: http.SameSiteLaxMode,
-			MaxAge:   int(sessionDuration.Seconds()),
-		})
+		setSessionCookie(w, token, duration)
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		target := "/"
+		if value, _ := getSetting(b.db, "dashboard_on_login"); value == "true" {
+			target = "/dashboard"
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
 	}
 }
 
@@ -422,6 +1714,7 @@ func (b *Blog) Logout(w http.ResponseWriter, r *http.Request) {
 		Name:   sessionCookieName,
 		Value:  "",
 		Path:   "/",
+		Domain: cookieDomain,
 		MaxAge: -1,
 	})
 
@@ -429,20 +1722,71 @@ func (b *Blog) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (b *Blog) Feed(w http.ResponseWriter, r *http.Request) {
-	posts, err := getPublishedPosts(b.db)
+	if !b.allowFeedRequest(w, r) {
+		return
+	}
+	b.announceDuePosts(r)
+
+	posts, err := b.posts.GetFeedPosts(b.feedLimit(r))
 	if err != nil {
 		log.Printf("fetching posts for feed: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		b.serverError(w, r)
+		return
+	}
+	if feedNotModified(w, r, b.db, posts) {
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	b.writeRSS(w, posts, getBlogName(b.db), baseURL, baseURL)
+}
+
+// TagFeed serves the published posts filed under a tag as an RSS feed, so
+// readers can subscribe to a single topic.
+func (b *Blog) TagFeed(w http.ResponseWriter, r *http.Request) {
+	if !b.allowFeedRequest(w, r) {
+		return
+	}
+
+	tag, err := b.posts.GetTag(r.PathValue("slug"))
+	if err != nil {
+		log.Printf("fetching tag for feed: %v", err)
+		b.serverError(w, r)
+		return
+	}
+	if tag == nil {
+		b.NotFound(w, r)
+		return
+	}
+
+	posts, err := b.posts.GetByTag(tag.Slug, false)
+	if err != nil {
+		log.Printf("fetching posts for tag %q feed: %v", tag.Slug, err)
+		b.serverError(w, r)
+		return
+	}
+	if limit := b.feedLimit(r); len(posts) > limit {
+		posts = posts[:limit]
+	}
+	if feedNotModified(w, r, b.db, posts) {
 		return
 	}
 
-	scheme := "https"
-	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
-		scheme = proto
-	} else if r.TLS == nil {
-		scheme = "http"
+	baseURL := requestBaseURL(r)
+	title := fmt.Sprintf("%s — Tagged %s", getBlogName(b.db), tag.Name)
+	b.writeRSS(w, posts, title, baseURL+"/tag/"+tag.Slug, baseURL)
+}
+
+// writeRSS writes posts as an RSS 2.0 feed titled title, whose channel
+// links to link. Post links are made absolute against baseURL.
+func (b *Blog) writeRSS(w http.ResponseWriter, posts []Post, title, link, baseURL string) {
+	blogName := getBlogName(b.db)
+
+	// RSS wants an email in <author>, conventionally followed by the name
+	var author string
+	if email := getAuthorEmail(b.db); email != "" {
+		author = fmt.Sprintf("%s (%s)", email, blogName)
 	}
-	baseURL := scheme + "://" + r.Host
 
 	items := make([]rssItem, len(posts))
 	for i, post := range posts {
@@ -451,25 +1795,34 @@ func (b *Blog) Feed(w http.ResponseWriter, r *http.Request) {
 			Title:       post.Title,
 			Link:        postURL,
 			GUID:        postURL,
+			Author:      author,
 			PubDate:     post.CreatedAt.UTC().Format(time.RFC1123Z),
-			Description: post.Content,
+			Description: absoluteLinks(post.Content, baseURL),
+		}
+		if post.Excerpt != "" {
+			items[i].Description = post.Excerpt
+		}
+		if image := postImageURL(b.db, &post, baseURL); image != "" {
+			items[i].Enclosure = imageEnclosure(image)
 		}
 	}
 
-	blogName := getBlogName(b.db)
 	description := "A personal blog"
 	if intro, _ := getSetting(b.db, "intro"); intro != "" {
-		description = truncate(intro, 160)
+		description = truncate(plainText(intro), 160)
 	}
 	feed := rss{
 		Version: "2.0",
 		Channel: rssChannel{
-			Title:       blogName,
-			Link:        baseURL,
+			Title:       title,
+			Link:        link,
 			Description: description,
 			Items:       items,
 		},
 	}
+	if imageURL := getFeedImageURL(b.db); imageURL != "" {
+		feed.Channel.Image = &rssImage{URL: imageURL, Title: title, Link: link}
+	}
 
 	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
 	w.Write([]byte(xml.Header))
@@ -477,3 +1830,253 @@ func (b *Blog) Feed(w http.ResponseWriter, r *http.Request) {
 		log.Printf("encoding RSS feed: %v", err)
 	}
 }
+
+// AtomFeed serves the same posts as Feed as an Atom 1.0 feed.
+func (b *Blog) AtomFeed(w http.ResponseWriter, r *http.Request) {
+	if !b.allowFeedRequest(w, r) {
+		return
+	}
+
+	posts, err := b.posts.GetFeedPosts(b.feedLimit(r))
+	if err != nil {
+		log.Printf("fetching posts for Atom feed: %v", err)
+		b.serverError(w, r)
+		return
+	}
+	if feedNotModified(w, r, b.db, posts) {
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	blogName := getBlogName(b.db)
+
+	// Atom requires <updated>, so an empty feed reports the current time
+	updated := time.Now()
+	if len(posts) > 0 {
+		updated = posts[0].CreatedAt
+	}
+
+	entries := make([]atomEntry, len(posts))
+	for i, post := range posts {
+		postURL := fmt.Sprintf("%s/%s", baseURL, post.Slug)
+		entries[i] = atomEntry{
+			Title:     post.Title,
+			ID:        postURL,
+			Published: post.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   post.LastModified().UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: postURL}},
+			Summary:   post.Excerpt,
+			Content:   atomContent{Type: "html", Body: string(format(absoluteLinks(post.Content, baseURL)))},
+		}
+		// Cross-posted entries also point readers at the original
+		if post.CanonicalURL != "" {
+			entries[i].Links = append(entries[i].Links, atomLink{Rel: "related", Type: "text/html", Href: post.CanonicalURL})
+		}
+	}
+
+	feed := atomFeed{
+		Title:   blogName,
+		ID:      baseURL + "/",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "alternate", Type: "text/html", Href: baseURL + "/"},
+			{Rel: "self", Type: "application/atom+xml", Href: baseURL + "/feed.atom"},
+		},
+		Author:  atomAuthor{Name: blogName, Email: getAuthorEmail(b.db)},
+		Logo:    getFeedImageURL(b.db),
+		Entries: entries,
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Printf("encoding Atom feed: %v", err)
+	}
+}
+
+// JSONFeed serves the same posts as Feed as a JSON Feed 1.1 document.
+func (b *Blog) JSONFeed(w http.ResponseWriter, r *http.Request) {
+	if !b.allowFeedRequest(w, r) {
+		return
+	}
+
+	posts, err := b.posts.GetFeedPosts(b.feedLimit(r))
+	if err != nil {
+		log.Printf("fetching posts for JSON feed: %v", err)
+		b.serverError(w, r)
+		return
+	}
+	if feedNotModified(w, r, b.db, posts) {
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	blogName := getBlogName(b.db)
+
+	items := make([]jsonFeedItem, len(posts))
+	for i, post := range posts {
+		postURL := fmt.Sprintf("%s/%s", baseURL, post.Slug)
+		items[i] = jsonFeedItem{
+			ID:            postURL,
+			URL:           postURL,
+			Title:         post.Title,
+			ContentHTML:   string(format(absoluteLinks(post.Content, baseURL))),
+			Summary:       post.Excerpt,
+			DatePublished: post.CreatedAt.UTC().Format(time.RFC3339),
+		}
+	}
+
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       blogName,
+		HomePageURL: baseURL + "/",
+		FeedURL:     baseURL + "/feed.json",
+		Icon:        getFeedImageURL(b.db),
+		Authors:     []jsonFeedAuthor{{Name: blogName}},
+		Items:       items,
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json")
+	if err := json.NewEncoder(w).Encode(feed); err != nil {
+		log.Printf("encoding JSON feed: %v", err)
+	}
+}
+
+func (b *Blog) Sitemap(w http.ResponseWriter, r *http.Request) {
+	posts, err := b.posts.GetPublishedPosts()
+	if err != nil {
+		log.Printf("fetching posts for sitemap: %v", err)
+		b.serverError(w, r)
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	hints := getSitemapHints(b.db)
+
+	home := sitemapURL{
+		Loc:        baseURL + "/",
+		ChangeFreq: hints.HomeChangeFreq,
+		Priority:   hints.HomePriority,
+	}
+	if len(posts) > 0 {
+		home.LastMod = posts[newestPost(posts)].CreatedAt.UTC().Format("2006-01-02")
+	}
+
+	urls := []sitemapURL{home}
+	for _, post := range posts {
+		if post.NoIndex {
+			continue
+		}
+		urls = append(urls, sitemapURL{
+			Loc:        fmt.Sprintf("%s/%s", baseURL, post.Slug),
+			LastMod:    post.CreatedAt.UTC().Format("2006-01-02"),
+			ChangeFreq: hints.PostChangeFreq,
+			Priority:   hints.PostPriority,
+		})
+	}
+
+	sitemap := sitemapURLSet{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		URLs:  urls,
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(sitemap); err != nil {
+		log.Printf("encoding sitemap: %v", err)
+	}
+}
+
+// exportDateLayout is the format of the export handler's from and to params.
+const exportDateLayout = "2006-01-02"
+
+// parseExportRange reads the optional from and to dates of an export. The
+// returned upper bound is exclusive, so to covers the whole of its day.
+func parseExportRange(r *http.Request) (from, to time.Time, err error) {
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(exportDateLayout, v); err != nil {
+			return from, to, fmt.Errorf("invalid from date %q", v)
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(exportDateLayout, v); err != nil {
+			return from, to, fmt.Errorf("invalid to date %q", v)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// Export streams a ZIP of posts as markdown files, optionally limited to
+// posts under a tag and to posts created between the from and to dates
+// (inclusive, YYYY-MM-DD).
+func (b *Blog) Export(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseExportRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var posts []Post
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		posts, err = b.posts.GetByTag(tag, true)
+	} else {
+		posts, err = b.posts.GetPosts()
+	}
+	if err != nil {
+		log.Printf("fetching posts for export: %v", err)
+		b.serverError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="posts.zip"`)
+
+	zw := zip.NewWriter(w)
+	for _, post := range posts {
+		if !from.IsZero() && post.CreatedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !post.CreatedAt.Before(to) {
+			continue
+		}
+
+		f, err := zw.Create(post.Slug + ".md")
+		if err != nil {
+			log.Printf("adding post %d to export: %v", post.ID, err)
+			return
+		}
+		fmt.Fprintf(f, "---\ntitle: %q\ndate: %s\npublished: %t\n---\n\n%s\n",
+			post.Title, post.CreatedAt.UTC().Format(time.RFC3339), post.Published, post.Content)
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("writing export: %v", err)
+	}
+}
+
+// robotsDisallow lists the admin paths crawlers are asked to skip.
+var robotsDisallow = []string{"/new", "/edit/", "/delete/", "/settings", "/dashboard", "/export", "/trash", "/go/"}
+
+// Robots serves robots.txt, pointing crawlers at the sitemap.
+func (b *Blog) Robots(w http.ResponseWriter, r *http.Request) {
+	var sb strings.Builder
+	sb.WriteString("User-agent: *\n")
+	for _, p := range robotsDisallow {
+		fmt.Fprintf(&sb, "Disallow: %s\n", p)
+	}
+	fmt.Fprintf(&sb, "\nSitemap: %s/sitemap.xml\n", requestBaseURL(r))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(sb.String()))
+}
+
+// Healthz reports whether the server and its database are reachable.
+func (b *Blog) Healthz(w http.ResponseWriter, r *http.Request) {
+	if err := b.db.Ping(); err != nil {
+		log.Printf("health check: %v", err)
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -25,7 +36,11 @@ func setupTestBlog(t *testing.T) *Blog {
 	}
 	t.Cleanup(func() { db.Close() })
 
-	return NewBlog(db)
+	blog, err := NewBlog(db)
+	if err != nil {
+		t.Fatalf("creating blog: %v", err)
+	}
+	return blog
 }
 
 // addCSRFToken adds a CSRF token to the request (cookie + form value)
@@ -61,6 +76,118 @@ func TestHome(t *testing.T) {
 	}
 }
 
+// fakePostStore is an in-memory PostStore for driving handlers without SQLite.
+// Methods it doesn't override fall through to the embedded (nil) interface
+// and panic, so tests notice if a handler starts depending on them.
+type fakePostStore struct {
+	PostStore
+	posts []Post
+}
+
+func (f *fakePostStore) GetPosts() ([]Post, error) {
+	return f.posts, nil
+}
+
+func (f *fakePostStore) GetPublishedPosts() ([]Post, error) {
+	var published []Post
+	for _, p := range f.posts {
+		if p.Published {
+			published = append(published, p)
+		}
+	}
+	return published, nil
+}
+
+func (f *fakePostStore) GetByID(id int) (*Post, error) {
+	for i := range f.posts {
+		if f.posts[i].ID == id {
+			return &f.posts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakePostStore) GetBySlug(slug string) (*Post, error) {
+	for i := range f.posts {
+		if f.posts[i].Slug == slug {
+			return &f.posts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakePostStore) Create(title, slug, content string, published bool) (string, error) {
+	slug = cmp.Or(generateSlug(slug, ""), generateSlug(title, ""))
+	f.posts = append(f.posts, Post{ID: len(f.posts) + 1, Title: title, Slug: slug, Content: content, Published: published})
+	return slug, nil
+}
+
+func (f *fakePostStore) Update(id int, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	post, _ := f.GetByID(id)
+	if post == nil {
+		return "", nil
+	}
+	post.Title, post.Slug, post.Content, post.Published = title, cmp.Or(generateSlug(slug, ""), generateSlug(title, "")), content, published
+	post.LastEditedBy = editorID
+	if !dates.Created.IsZero() {
+		post.CreatedAt = dates.Created
+	}
+	post.PublishAt = dates.PublishAt
+	return post.Slug, nil
+}
+
+func (f *fakePostStore) UpdateMeta(id int, meta PostMeta) error {
+	if post, _ := f.GetByID(id); post != nil {
+		post.PostMeta = meta
+	}
+	return nil
+}
+
+func (f *fakePostStore) Delete(id int) error {
+	for i := range f.posts {
+		if f.posts[i].ID == id {
+			f.posts = append(f.posts[:i], f.posts[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakePostStore) EnsureUniqueSlug(slug string, excludeID int) (string, error) {
+	return slug, nil
+}
+
+func TestHome_WithFakePostStore(t *testing.T) {
+	blog := setupTestBlog(t)
+	blog.posts = &fakePostStore{posts: []Post{
+		{ID: 1, Title: "Fake Published", Slug: "fake-published", Content: "Content", Published: true},
+		{ID: 2, Title: "Fake Draft", Slug: "fake-draft", Content: "Content", Published: false},
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Fake Published") {
+		t.Error("expected response to contain post from the fake store")
+	}
+	if strings.Contains(body, "Fake Draft") {
+		t.Error("expected draft from the fake store to be hidden")
+	}
+
+	// Nothing should have been written to the real database
+	posts, _ := getPosts(blog.db)
+	if len(posts) != 0 {
+		t.Errorf("expected SQLite store to be untouched, got %d posts", len(posts))
+	}
+}
+
 func TestDetail(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -99,6 +226,58 @@ func TestDetail_NotFound(t *testing.T) {
 	}
 }
 
+func TestDetail_NotFoundPage(t *testing.T) {
+	blog := setupTestBlog(t)
+	setSetting(blog.db, "theme", "sepia")
+	setSetting(blog.db, "blog_name", "My Notes")
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.SetPathValue("slug", "missing")
+	w := httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `data-theme="sepia"`) || !strings.Contains(body, "<title>My Notes — Not found</title>") {
+		t.Error("expected the 404 page to use the site template and settings")
+	}
+}
+
+// failingPostStore is a PostStore whose listings always fail.
+type failingPostStore struct {
+	PostStore
+}
+
+func (failingPostStore) GetPosts() ([]Post, error) {
+	return nil, errors.New("database is locked")
+}
+
+func (failingPostStore) GetPublishedPosts() ([]Post, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestHome_ServerErrorPage(t *testing.T) {
+	blog := setupTestBlog(t)
+	blog.posts = failingPostStore{}
+	setSetting(blog.db, "theme", "sepia")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `data-theme="sepia"`) || !strings.Contains(body, "<h1>Something went wrong</h1>") {
+		t.Error("expected the themed error page")
+	}
+}
+
 func TestCreate_GET(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -215,6 +394,59 @@ func TestEdit_POST(t *testing.T) {
 	}
 }
 
+func TestEdit_POST_ManualSlug(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Original", "Content", true)
+
+	form := url.Values{}
+	form.Set("title", "Renamed")
+	form.Set("slug", "Keep This Link")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	if loc := w.Header().Get("Location"); loc != "/keep-this-link" {
+		t.Errorf("expected redirect to /keep-this-link, got %q", loc)
+	}
+}
+
+func TestDetail_RedirectsRenamedSlug(t *testing.T) {
+	blog := setupTestBlog(t)
+	oldSlug, _ := createPost(blog.db, "Old Title", "Content", true)
+
+	form := url.Values{}
+	form.Set("title", "New Title")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", "1")
+	blog.Edit(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+oldSlug, nil)
+	req.SetPathValue("slug", oldSlug)
+	w := httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected status %d, got %d", http.StatusMovedPermanently, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/new-title" {
+		t.Errorf("expected redirect to /new-title, got %q", loc)
+	}
+}
+
 func TestDelete_POST(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -223,7 +455,13 @@ func TestDelete_POST(t *testing.T) {
 		t.Fatalf("creating test post: %v", err)
 	}
 
+	token, err := createDeleteToken(blog.db, 1)
+	if err != nil {
+		t.Fatalf("creating delete token: %v", err)
+	}
+
 	form := url.Values{}
+	form.Set("delete_token", token)
 	req := httptest.NewRequest(http.MethodPost, "/delete/1", nil)
 	addCSRFToken(req, form)
 	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
@@ -237,10 +475,116 @@ func TestDelete_POST(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusSeeOther, w.Code)
 	}
 
-	// Verify post was deleted
+	// Verify post was moved to the trash
 	post, _ := getPostByID(blog.db, 1)
-	if post != nil {
-		t.Error("expected post to be deleted")
+	if post == nil || post.DeletedAt.IsZero() {
+		t.Error("expected post to be in the trash")
+	}
+}
+
+func TestTrash_POST(t *testing.T) {
+	tests := []struct {
+		action    string
+		wantFound bool
+		wantTrash bool
+	}{
+		{"restore", true, false},
+		{"purge", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			createPost(blog.db, "Trashed", "Content", true)
+			deletePost(blog.db, 1)
+
+			form := url.Values{}
+			req := httptest.NewRequest(http.MethodPost, "/trash/1/"+tt.action, nil)
+			addCSRFToken(req, form)
+			req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", "1")
+			req.SetPathValue("action", tt.action)
+			w := httptest.NewRecorder()
+
+			blog.Trash(w, req)
+
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("expected status %d, got %d", http.StatusSeeOther, w.Code)
+			}
+			post, _ := getPostByID(blog.db, 1)
+			if (post != nil) != tt.wantFound {
+				t.Fatalf("expected post found = %v", tt.wantFound)
+			}
+			trash, _ := getDeletedPosts(blog.db)
+			if (len(trash) > 0) != tt.wantTrash {
+				t.Errorf("expected trash non-empty = %v, got %d posts", tt.wantTrash, len(trash))
+			}
+		})
+	}
+}
+
+func TestTrash_GET(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Kept", "Content", true)
+	createPost(blog.db, "Trashed", "Content", true)
+	deletePost(blog.db, 2)
+
+	req := httptest.NewRequest(http.MethodGet, "/trash", nil)
+	w := httptest.NewRecorder()
+
+	blog.Trash(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Trashed") || !strings.Contains(body, "/trash/2/restore") {
+		t.Error("expected trashed post with a restore button")
+	}
+	if strings.Contains(body, "Kept") {
+		t.Error("expected live post to be left out of the trash")
+	}
+}
+
+func TestDelete_POST_InvalidToken(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Keep Me", "Content", true)
+	createPost(blog.db, "Other", "Content", true)
+	otherToken, _ := createDeleteToken(blog.db, 2)
+	usedToken, _ := createDeleteToken(blog.db, 1)
+	consumeDeleteToken(blog.db, usedToken, 1)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing token", ""},
+		{"token for another post", otherToken},
+		{"reused token", usedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Set("delete_token", tt.token)
+			req := httptest.NewRequest(http.MethodPost, "/delete/1", nil)
+			addCSRFToken(req, form)
+			req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", "1")
+			w := httptest.NewRecorder()
+
+			blog.Delete(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+			}
+			if post, _ := getPostByID(blog.db, 1); post == nil {
+				t.Error("expected post to survive")
+			}
+		})
 	}
 }
 
@@ -315,6 +659,144 @@ func TestDetail_Draft_Authenticated(t *testing.T) {
 	}
 }
 
+func TestDetail_Scheduled(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Scheduled Post", "Content", true)
+	updatePost(blog.db, 1, "Scheduled Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(time.Hour)}, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	w := httptest.NewRecorder()
+	blog.Detail(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for scheduled post without auth, got %d", http.StatusNotFound, w.Code)
+	}
+
+	token, _ := createSession(blog.db, 1)
+	req = httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w = httptest.NewRecorder()
+	blog.Detail(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d for scheduled post with auth, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "This post is scheduled for") {
+		t.Error("expected scheduled banner for the author")
+	}
+}
+
+func TestHome_ScheduledPosts(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Published Post", "Content", true)
+	createPost(blog.db, "Scheduled Post", "Content", true)
+	updatePost(blog.db, 2, "Scheduled Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(time.Hour)}, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	blog.Home(w, req)
+	if strings.Contains(w.Body.String(), "Scheduled Post") {
+		t.Error("expected scheduled post to be hidden from unauthenticated user")
+	}
+
+	token, _ := createSession(blog.db, 1)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w = httptest.NewRecorder()
+	blog.Home(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, "Scheduled Post") {
+		t.Error("expected scheduled post to be shown to authenticated user")
+	}
+	if strings.Count(body, `<span class="draft-label">Scheduled</span>`) != 1 {
+		t.Error("expected exactly the scheduled post to carry a Scheduled label")
+	}
+}
+
+func TestBucketPosts(t *testing.T) {
+	posts := []Post{
+		{Title: "Scheduled", Published: true, PublishAt: time.Now().Add(time.Hour)},
+		{Title: "Published", Published: true},
+		{Title: "Draft", Published: false, PublishAt: time.Now().Add(time.Hour)},
+		{Title: "Due", Published: true, PublishAt: time.Now().Add(-time.Hour)},
+	}
+
+	published, scheduled, drafts := bucketPosts(posts)
+
+	titles := func(posts []Post) []string {
+		var titles []string
+		for _, p := range posts {
+			titles = append(titles, p.Title)
+		}
+		return titles
+	}
+	if got := titles(published); !slices.Equal(got, []string{"Published", "Due"}) {
+		t.Errorf("published = %v", got)
+	}
+	if got := titles(scheduled); !slices.Equal(got, []string{"Scheduled"}) {
+		t.Errorf("scheduled = %v", got)
+	}
+	if got := titles(drafts); !slices.Equal(got, []string{"Draft"}) {
+		t.Errorf("drafts = %v", got)
+	}
+}
+
+func TestCreate_POST_Scheduled(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	form := url.Values{}
+	form.Set("title", "Later")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("publish_at", time.Now().Add(24*time.Hour).UTC().Format(dateTimeLocalLayout))
+
+	req := httptest.NewRequest(http.MethodPost, "/new", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	blog.Create(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	post, _ := getPostByID(blog.db, 1)
+	if post == nil || !post.IsScheduled() {
+		t.Fatalf("expected a scheduled post, got %+v", post)
+	}
+	if published, _ := getPublishedPosts(blog.db); len(published) != 0 {
+		t.Errorf("expected no public posts, got %d", len(published))
+	}
+}
+
+func TestHome_Counts(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Published One", "Content", true)
+	createPost(blog.db, "Published Two", "Content", true)
+	createPost(blog.db, "Draft One", "Content", false)
+
+	token, _ := createSession(blog.db, 1)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	blog.Home(w, req)
+
+	if !strings.Contains(w.Body.String(), `<p class="counts">2 published, 1 draft</p>`) {
+		t.Error("expected post and draft counts for authenticated user")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	blog.Home(w, req)
+
+	if strings.Contains(w.Body.String(), `class="counts"`) {
+		t.Error("expected no counts for unauthenticated user")
+	}
+}
+
 func TestHome_HidesDraftsFromUnauthenticated(t *testing.T) {
 	blog := setupTestBlog(t)
 
@@ -356,6 +838,43 @@ func TestHome_ShowsDraftsToAuthenticated(t *testing.T) {
 	if !strings.Contains(body, "Draft Post") {
 		t.Error("expected response to contain 'Draft Post' for authenticated user")
 	}
+	if strings.Count(body, `<span class="draft-label">Draft</span>`) != 1 {
+		t.Error("expected exactly the draft to carry a Draft label")
+	}
+}
+
+func TestEdit_POST_Conflict(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Original", "Content", true)
+	post, _ := getPostByID(blog.db, 1)
+	version := post.Version()
+
+	// Another tab saves first
+	updatePost(blog.db, 1, "Other Tab", "", "Content", true, PostDates{}, 1)
+
+	form := url.Values{}
+	form.Set("title", "This Tab")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("updated_at", version)
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	req.SetPathValue("id", "1")
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	post, _ = getPostByID(blog.db, 1)
+	if post.Title != "Other Tab" {
+		t.Errorf("expected conflicting save to be rejected, got title %q", post.Title)
+	}
 }
 
 func TestEdit_ConvertToDraft(t *testing.T) {
@@ -466,16 +985,249 @@ func TestFeed(t *testing.T) {
 	}
 }
 
-func TestFeed_Empty(t *testing.T) {
+func TestFeed_Scheduled(t *testing.T) {
 	blog := setupTestBlog(t)
 
+	createPost(blog.db, "Future Post", "Content", true)
+	createPost(blog.db, "Due Post", "Content", true)
+	updatePost(blog.db, 1, "Future Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(time.Hour)}, 1)
+	updatePost(blog.db, 2, "Due Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(-time.Hour)}, 1)
+
 	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
 	w := httptest.NewRecorder()
-
 	blog.Feed(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	body := w.Body.String()
+	if strings.Contains(body, "Future Post") {
+		t.Error("scheduled post should not appear in feed before its publish time")
+	}
+	if !strings.Contains(body, "Due Post") {
+		t.Error("expected post past its publish time in feed")
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "First Post", "First content", true)
+	createPost(blog.db, "Second Post", "Second **bold** content", true)
+	createPost(blog.db, "Draft Post", "Draft content", false)
+	updatePostMeta(blog.db, 1, PostMeta{CanonicalURL: "https://elsewhere.example/original"})
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.atom", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.AtomFeed(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("expected Content-Type application/atom+xml, got %s", ct)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<feed xmlns="http://www.w3.org/2005/Atom">`) {
+		t.Error("expected Atom namespace on feed element")
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("parsing feed: %v", err)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(feed.Entries))
+	}
+	if strings.Contains(body, "Draft Post") {
+		t.Error("draft should not appear in feed")
+	}
+
+	entry := feed.Entries[0]
+	if entry.ID != "http://example.com/second-post" || len(entry.Links) != 1 || entry.Links[0].Href != entry.ID || entry.Links[0].Rel != "alternate" {
+		t.Errorf("unexpected entry id/links %q %+v", entry.ID, entry.Links)
+	}
+	syndicated := feed.Entries[1].Links
+	if len(syndicated) != 2 || syndicated[1].Rel != "related" || syndicated[1].Href != "https://elsewhere.example/original" {
+		t.Errorf("expected a related link to the canonical URL, got %+v", syndicated)
+	}
+	if entry.Content.Type != "html" || !strings.Contains(entry.Content.Body, "<strong>bold</strong>") {
+		t.Errorf("expected entry content rendered to HTML, got %+v", entry.Content)
+	}
+	if feed.Updated != entry.Updated {
+		t.Errorf("expected feed updated %q to match newest entry %q", feed.Updated, entry.Updated)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "First Post", "Some **bold** content", true)
+	createPost(blog.db, "Draft Post", "Draft content", false)
+
+	req := httptest.NewRequest(http.MethodGet, "/feed.json", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.JSONFeed(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/feed+json" {
+		t.Errorf("expected Content-Type application/feed+json, got %s", ct)
+	}
+
+	var feed jsonFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("parsing feed: %v", err)
+	}
+	if feed.Version != "https://jsonfeed.org/version/1.1" || feed.FeedURL != "http://example.com/feed.json" {
+		t.Errorf("unexpected feed header %+v", feed)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.ID != "http://example.com/first-post" || item.URL != item.ID {
+		t.Errorf("expected slug-based id and url, got %q %q", item.ID, item.URL)
+	}
+	if !strings.Contains(item.ContentHTML, "<strong>bold</strong>") {
+		t.Errorf("expected formatted content, got %q", item.ContentHTML)
+	}
+}
+
+func TestFeed_ConditionalGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		handler func(*Blog) http.HandlerFunc
+	}{
+		{"rss", "/feed", func(b *Blog) http.HandlerFunc { return b.Feed }},
+		{"atom", "/feed.atom", func(b *Blog) http.HandlerFunc { return b.AtomFeed }},
+		{"json", "/feed.json", func(b *Blog) http.HandlerFunc { return b.JSONFeed }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			createPost(blog.db, "First Post", "Content", true)
+			handler := tt.handler(blog)
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			etag := w.Header().Get("ETag")
+			lastModified := w.Header().Get("Last-Modified")
+			if etag == "" || lastModified == "" {
+				t.Fatalf("expected ETag and Last-Modified, got %q and %q", etag, lastModified)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("expected status %d for matching If-None-Match, got %d", http.StatusNotModified, w.Code)
+			}
+			if w.Body.Len() != 0 {
+				t.Error("expected empty body for 304")
+			}
+
+			req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("If-Modified-Since", lastModified)
+			w = httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("expected status %d for current If-Modified-Since, got %d", http.StatusNotModified, w.Code)
+			}
+
+			createPost(blog.db, "Second Post", "Content", true)
+			req = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status %d after a new post, got %d", http.StatusOK, w.Code)
+			}
+		})
+	}
+}
+
+func TestFeed_RateLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		block      string
+		wantStatus int
+	}{
+		{"log only", "", http.StatusOK},
+		{"blocking", "true", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			setSetting(blog.db, "feed_rate_limit", "3")
+			setSetting(blog.db, "feed_rate_limit_block", tt.block)
+
+			fetch := func(remoteAddr string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+				req.RemoteAddr = remoteAddr
+				w := httptest.NewRecorder()
+				blog.Feed(w, req)
+				return w
+			}
+
+			for i := 1; i <= 3; i++ {
+				if w := fetch("192.0.2.1:1234"); w.Code != http.StatusOK {
+					t.Fatalf("request %d: expected status %d, got %d", i, http.StatusOK, w.Code)
+				}
+			}
+			w := fetch("192.0.2.1:1234")
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d over the limit, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "3600" {
+				t.Errorf("expected Retry-After 3600, got %q", w.Header().Get("Retry-After"))
+			}
+			if w := fetch("192.0.2.2:1234"); w.Code != http.StatusOK {
+				t.Errorf("expected other readers to be unaffected, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestFeed_RateLimitBehindProxy(t *testing.T) {
+	blog := setupTestBlog(t)
+	setSetting(blog.db, "feed_rate_limit", "1")
+	setSetting(blog.db, "feed_rate_limit_block", "true")
+	trustProxy = true
+	t.Cleanup(func() { trustProxy = false })
+
+	fetch := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		blog.Feed(w, req)
+		return w.Code
+	}
+
+	fetch("192.0.2.1")
+	if code := fetch("192.0.2.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d over the limit, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := fetch("192.0.2.2"); code != http.StatusOK {
+		t.Errorf("expected another reader behind the same proxy to be unaffected, got %d", code)
+	}
+}
+
+func TestFeed_Empty(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	w := httptest.NewRecorder()
+
+	blog.Feed(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
 	body := w.Body.String()
@@ -647,3 +1399,2050 @@ func TestLegacyPostRedirect(t *testing.T) {
 		t.Errorf("expected redirect to '/my-old-slug', got %q", location)
 	}
 }
+
+func TestLegacyPostRedirect_ID(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Renamed Post", "Content", true)
+	createPost(blog.db, "Draft Post", "Content", false)
+
+	tests := []struct {
+		name         string
+		id           string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"published post", "1", http.StatusMovedPermanently, "/renamed-post"},
+		{"draft", "2", http.StatusNotFound, ""},
+		{"unknown id", "99", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/post/"+tt.id, nil)
+			req.SetPathValue("slug", tt.id)
+			w := httptest.NewRecorder()
+
+			blog.LegacyPostRedirect(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("expected redirect to %q, got %q", tt.wantLocation, location)
+			}
+		})
+	}
+}
+
+func TestRobots(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.Robots(w, req)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected Content-Type text/plain, got %s", ct)
+	}
+	body := w.Body.String()
+	for _, path := range []string{"/settings", "/dashboard", "/export", "/trash", "/go/"} {
+		if !strings.Contains(body, "Disallow: "+path+"\n") {
+			t.Errorf("expected %s to be disallowed", path)
+		}
+	}
+	if !strings.Contains(body, "Sitemap: http://example.com/sitemap.xml") {
+		t.Error("expected a Sitemap line")
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Mapped Post", "Content", true)
+	createPost(blog.db, "Draft Post", "Content", false)
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.Sitemap(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+		t.Errorf("expected Content-Type application/xml, got %s", ct)
+	}
+	if strings.Contains(w.Body.String(), "draft-post") {
+		t.Error("expected drafts to be left out of the sitemap")
+	}
+
+	var sitemap sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &sitemap); err != nil {
+		t.Fatalf("parsing sitemap: %v", err)
+	}
+	if len(sitemap.URLs) != 2 {
+		t.Fatalf("expected 2 URLs (home + post), got %d", len(sitemap.URLs))
+	}
+
+	home, post := sitemap.URLs[0], sitemap.URLs[1]
+	if home.Loc != "http://example.com/" || post.Loc != "http://example.com/mapped-post" {
+		t.Errorf("unexpected locations %q and %q", home.Loc, post.Loc)
+	}
+	if home.ChangeFreq != "daily" || post.ChangeFreq != "weekly" {
+		t.Errorf("expected default changefreq daily/weekly, got %q/%q", home.ChangeFreq, post.ChangeFreq)
+	}
+
+	homePriority, _ := strconv.ParseFloat(home.Priority, 64)
+	postPriority, _ := strconv.ParseFloat(post.Priority, 64)
+	if homePriority <= postPriority {
+		t.Errorf("expected home priority %s to be higher than post priority %s", home.Priority, post.Priority)
+	}
+}
+
+func TestSitemap_HomeLastModWithPinnedPost(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Pinned Post", "Content", true)
+	createPost(blog.db, "Newest Post", "Content", true)
+	blog.db.Exec("UPDATE posts SET pinned = 1, created_at = '2023-06-01 12:00:00' WHERE id = 1")
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	w := httptest.NewRecorder()
+	blog.Sitemap(w, req)
+
+	var sitemap sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &sitemap); err != nil {
+		t.Fatalf("parsing sitemap: %v", err)
+	}
+	newest, _ := getPostByID(blog.db, 2)
+	if want := newest.CreatedAt.UTC().Format("2006-01-02"); sitemap.URLs[0].LastMod != want {
+		t.Errorf("expected home lastmod %s from the newest post, got %s", want, sitemap.URLs[0].LastMod)
+	}
+}
+
+func TestSitemap_HintsFromSettings(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Mapped Post", "Content", true)
+	setSetting(blog.db, "sitemap_post_changefreq", "monthly")
+	setSetting(blog.db, "sitemap_post_priority", "0.3")
+	setSetting(blog.db, "sitemap_home_changefreq", "sometimes") // invalid, falls back
+
+	req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	w := httptest.NewRecorder()
+
+	blog.Sitemap(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<changefreq>monthly</changefreq><priority>0.3</priority>") {
+		t.Error("expected post hints from settings")
+	}
+	if !strings.Contains(body, "<changefreq>daily</changefreq>") {
+		t.Error("expected invalid home changefreq to fall back to daily")
+	}
+}
+
+func TestNoIndexPost(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Indexed Post", "Content", true)
+	createPost(blog.db, "Contact", "Reach me here", true)
+	post, _ := getPostBySlug(blog.db, "contact")
+	if err := updatePostMeta(blog.db, post.ID, PostMeta{NoIndex: true}); err != nil {
+		t.Fatalf("updatePostMeta() error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/contact", nil)
+	req.SetPathValue("slug", "contact")
+	w := httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("X-Robots-Tag"); got != "noindex" {
+		t.Errorf("expected X-Robots-Tag noindex, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `<meta name="robots" content="noindex">`) {
+		t.Error("expected robots noindex meta tag")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+	w = httptest.NewRecorder()
+
+	blog.Sitemap(w, req)
+
+	body := w.Body.String()
+	if strings.Contains(body, "/contact</loc>") {
+		t.Error("expected noindex post to be absent from sitemap")
+	}
+	if !strings.Contains(body, "/indexed-post</loc>") {
+		t.Error("expected indexed post in sitemap")
+	}
+}
+
+func TestDetail_CanonicalURL(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Local Post", "Content", true)
+	createPost(blog.db, "Syndicated Post", "Content", true)
+	updatePostMeta(blog.db, 2, PostMeta{CanonicalURL: "https://elsewhere.example/original"})
+
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{slug, `<link rel="canonical" href="http://example.com/local-post">`},
+		{"syndicated-post", `<link rel="canonical" href="https://elsewhere.example/original">`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.slug, nil)
+			req.Host = "example.com"
+			req.SetPathValue("slug", tt.slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("expected detail head to contain %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestEdit_POST_InvalidCanonicalURL(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Original", "Content", true)
+
+	form := url.Values{}
+	form.Set("title", "Original")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("canonical_url", "javascript:alert(1)")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	post, _ := getPostByID(blog.db, 1)
+	if post.CanonicalURL != "" {
+		t.Errorf("expected canonical URL to stay empty, got %q", post.CanonicalURL)
+	}
+}
+
+func TestDetail_LinkTemplate(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Worth Reading", "Via [an article](https://example.com/article) I liked.", true)
+	updatePostMeta(blog.db, 1, PostMeta{Template: "link.html"})
+
+	req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	w := httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<article class="link-post">`) {
+		t.Error("expected the post to render with link.html")
+	}
+	if !strings.Contains(body, `<a href="https://example.com/article">Worth Reading</a>`) {
+		t.Error("expected the title to link to the post's first link")
+	}
+}
+
+func TestAdminNotes(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Noted", "Content", true)
+	updatePostMeta(blog.db, 1, PostMeta{AdminNotes: "Secret source"})
+
+	req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	w := httptest.NewRecorder()
+	blog.Detail(w, req)
+	if strings.Contains(w.Body.String(), "Secret source") {
+		t.Error("expected admin notes to be hidden from anonymous visitors")
+	}
+
+	token, _ := createSession(blog.db, 1)
+	req = httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	w = httptest.NewRecorder()
+	blog.Detail(w, req)
+	if !strings.Contains(w.Body.String(), "Secret source") {
+		t.Error("expected admin notes to be shown to the author")
+	}
+
+	feeds := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/feed", blog.Feed},
+		{"/feed.atom", blog.AtomFeed},
+		{"/feed.json", blog.JSONFeed},
+	}
+	for _, feed := range feeds {
+		req = httptest.NewRequest(http.MethodGet, feed.path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		w = httptest.NewRecorder()
+		feed.handler(w, req)
+		if strings.Contains(w.Body.String(), "Secret source") {
+			t.Errorf("expected admin notes to be left out of %s", feed.path)
+		}
+	}
+}
+
+func TestDetail_Related(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Main Post", "Content", true)
+	createPost(blog.db, "Sibling Post", "Content", true)
+	createPost(blog.db, "Unrelated Post", "Content", true)
+	setPostTags(blog.db, 1, []string{"go", "web"})
+	setPostTags(blog.db, 2, []string{"go"})
+	setPostTags(blog.db, 3, []string{"misc"})
+
+	get := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+		req.SetPathValue("slug", slug)
+		w := httptest.NewRecorder()
+		blog.Detail(w, req)
+		return w.Body.String()
+	}
+
+	body := get()
+	if !strings.Contains(body, `<section class="related">`) || !strings.Contains(body, "Sibling Post") {
+		t.Error("expected the post sharing a tag to be listed as related")
+	}
+	if strings.Contains(body, "Unrelated Post") {
+		t.Error("expected posts without shared tags to be left out")
+	}
+
+	updatePostMeta(blog.db, 1, PostMeta{ShowRelated: false})
+
+	body = get()
+	if strings.Contains(body, `<section class="related">`) || strings.Contains(body, "Sibling Post") {
+		t.Error("expected no related section when show_related is off")
+	}
+}
+
+func TestEdit_POST_InvalidTemplate(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Original", "Content", true)
+
+	form := url.Values{}
+	form.Set("title", "Original")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("template", "../admin.html")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	post, _ := getPostByID(blog.db, 1)
+	if post.DetailTemplate() != "detail.html" {
+		t.Errorf("expected default layout to be kept, got %q", post.DetailTemplate())
+	}
+}
+
+func TestCreate_POST_DuplicateSubmission(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	submit := func(force bool) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("title", "Same Post")
+		form.Set("content", "Same content")
+		form.Set("action", "publish")
+		if force {
+			form.Set("force", "1")
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/new", nil)
+		addCSRFToken(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		blog.Create(w, req)
+		return w
+	}
+
+	submit(false)
+	w := submit(false)
+
+	if location := w.Header().Get("Location"); location != "/same-post" {
+		t.Errorf("expected duplicate to redirect to existing post, got %q", location)
+	}
+	posts, _ := getPosts(blog.db)
+	if len(posts) != 1 {
+		t.Fatalf("expected duplicate submission to be ignored, got %d posts", len(posts))
+	}
+
+	w = submit(true)
+
+	if location := w.Header().Get("Location"); location != "/same-post-2" {
+		t.Errorf("expected forced duplicate at '/same-post-2', got %q", location)
+	}
+	posts, _ = getPosts(blog.db)
+	if len(posts) != 2 {
+		t.Errorf("expected forced submission to create a second post, got %d posts", len(posts))
+	}
+}
+
+func TestFeed_Image(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		want    string
+	}{
+		{"configured", "https://example.com/logo.png", "https://example.com/logo.png"},
+		{"unset", "", ""},
+		{"invalid", "javascript:alert(1)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			setSetting(blog.db, "feed_image_url", tt.setting)
+
+			req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+			req.Host = "example.com"
+			w := httptest.NewRecorder()
+
+			blog.Feed(w, req)
+
+			var feed rss
+			if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("parsing feed: %v", err)
+			}
+			image := feed.Channel.Image
+			if tt.want == "" {
+				if image != nil {
+					t.Errorf("expected no channel image, got %+v", image)
+				}
+				return
+			}
+			if image == nil {
+				t.Fatal("expected channel image")
+			}
+			if image.URL != tt.want || image.Link != "http://example.com" || image.Title == "" {
+				t.Errorf("unexpected channel image %+v", image)
+			}
+		})
+	}
+}
+
+func TestFeed_AuthorEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		want    string
+	}{
+		{"configured", "me@example.com", "me@example.com (Test Blog)"},
+		{"unset", "", ""},
+		{"invalid", "not an email", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			createPost(blog.db, "Feed Post", "Content", true)
+			setSetting(blog.db, "blog_name", "Test Blog")
+			setSetting(blog.db, "author_email", tt.setting)
+
+			req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+			w := httptest.NewRecorder()
+
+			blog.Feed(w, req)
+
+			var feed rss
+			if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("parsing feed: %v", err)
+			}
+			if len(feed.Channel.Items) != 1 {
+				t.Fatalf("expected 1 item, got %d", len(feed.Channel.Items))
+			}
+			if got := feed.Channel.Items[0].Author; got != tt.want {
+				t.Errorf("expected author %q, got %q", tt.want, got)
+			}
+			if tt.want == "" && strings.Contains(w.Body.String(), "<author>") {
+				t.Error("expected <author> to be omitted")
+			}
+		})
+	}
+}
+
+func TestFeed_AbsoluteLinks(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Pictures", "![logo](/static/foo.png) and [more](/other-post)", true)
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.Feed(w, req)
+
+	var feed rss
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("parsing feed: %v", err)
+	}
+	want := "![logo](http://example.com/static/foo.png) and [more](http://example.com/other-post)"
+	if got := feed.Channel.Items[0].Description; got != want {
+		t.Errorf("expected feed content %q, got %q", want, got)
+	}
+
+	// The post page itself is untouched
+	req = httptest.NewRequest(http.MethodGet, "/pictures", nil)
+	req.Host = "example.com"
+	req.SetPathValue("slug", "pictures")
+	w = httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "(/static/foo.png)") || strings.Contains(body, "http://example.com/static/foo.png") {
+		t.Error("expected the post page to keep the relative path")
+	}
+}
+
+func TestHome_FeedNegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		setting  string
+		accept   string
+		wantFeed bool
+	}{
+		{"enabled with RSS accept", "true", "application/rss+xml", true},
+		{"enabled with atom accept", "true", "application/atom+xml;q=0.9", true},
+		{"enabled with browser accept", "true", "text/html,application/xhtml+xml,application/rss+xml;q=0.8", false},
+		{"disabled with RSS accept", "", "application/rss+xml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			createPost(blog.db, "Feed Post", "Content", true)
+			setSetting(blog.db, "negotiate_home_feed", tt.setting)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			blog.Home(w, req)
+
+			isFeed := strings.HasPrefix(w.Header().Get("Content-Type"), "application/rss+xml")
+			if isFeed != tt.wantFeed {
+				t.Errorf("expected feed %v, got Content-Type %q", tt.wantFeed, w.Header().Get("Content-Type"))
+			}
+			if tt.wantFeed && !strings.Contains(w.Body.String(), "<item>") {
+				t.Error("expected feed items in response")
+			}
+		})
+	}
+}
+
+func TestAutoDetectImages(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Gallery", "Look:\n\n![photo](/static/photo.png)", true)
+	setSetting(blog.db, "auto_detect_images", "true")
+
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	blog.Feed(w, req)
+
+	var feed rss
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("parsing feed: %v", err)
+	}
+	enclosure := feed.Channel.Items[0].Enclosure
+	if enclosure == nil || enclosure.URL != "http://example.com/static/photo.png" || enclosure.Type != "image/png" {
+		t.Errorf("unexpected enclosure %+v", enclosure)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/gallery", nil)
+	req.Host = "example.com"
+	req.SetPathValue("slug", "gallery")
+	w = httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	if !strings.Contains(w.Body.String(), `<meta property="og:image" content="http://example.com/static/photo.png">`) {
+		t.Error("expected og:image meta tag")
+	}
+
+	// Off by default
+	setSetting(blog.db, "auto_detect_images", "")
+	w = httptest.NewRecorder()
+	blog.Detail(w, req)
+	if strings.Contains(w.Body.String(), "og:image") {
+		t.Error("expected no og:image when disabled")
+	}
+}
+
+func TestDetail_OGImageFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		content  string
+		siteWide string
+		want     string
+	}{
+		{"override wins", "https://cdn.example/override.png", "![a](/static/photo.png)", "https://cdn.example/default.png", "https://cdn.example/override.png"},
+		{"content image", "", "![a](/static/photo.png)", "https://cdn.example/default.png", "http://example.com/static/photo.png"},
+		{"site default", "", "No images here", "https://cdn.example/default.png", "https://cdn.example/default.png"},
+		{"invalid default ignored", "", "No images here", "javascript:alert(1)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			setSetting(blog.db, "auto_detect_images", "true")
+			setSetting(blog.db, "default_og_image", tt.siteWide)
+
+			slug, _ := createPost(blog.db, "Preview", tt.content, true)
+			updatePostMeta(blog.db, 1, PostMeta{OGImage: tt.override})
+
+			req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+			req.Host = "example.com"
+			req.SetPathValue("slug", slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			body := w.Body.String()
+			if tt.want == "" {
+				if strings.Contains(body, "og:image") {
+					t.Error("expected no og:image")
+				}
+				return
+			}
+			if !strings.Contains(body, `<meta property="og:image" content="`+tt.want+`">`) {
+				t.Errorf("expected og:image %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestFeed_Limit(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	for i := 1; i <= maxFeedItems+5; i++ {
+		createPost(blog.db, fmt.Sprintf("Post %d", i), "Content", true)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"default", "", defaultFeedItems},
+		{"explicit limit", "?limit=5", 5},
+		{"huge limit clamped", "?limit=100000", maxFeedItems},
+		{"invalid limit ignored", "?limit=abc", defaultFeedItems},
+		{"negative limit ignored", "?limit=-3", defaultFeedItems},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/feed"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			blog.Feed(w, req)
+
+			if got := strings.Count(w.Body.String(), "<item>"); got != tt.want {
+				t.Errorf("expected %d items, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEdit_POST_RecordsEditor(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Original", "Content", true)
+	token, _ := createSession(blog.db, 7)
+
+	form := url.Values{}
+	form.Set("title", "Edited")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+
+	blog.requireAuth(blog.Edit)(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, w.Code)
+	}
+
+	post, _ := getPostByID(blog.db, 1)
+	if post.LastEditedBy != 7 {
+		t.Errorf("expected last_edited_by 7, got %d", post.LastEditedBy)
+	}
+}
+
+func TestSearch_SortOldest(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Older Match", "Content", true)
+	createPost(blog.db, "Newer Match", "Content", true)
+	blog.db.Exec("UPDATE posts SET created_at = datetime('now', '-1 days') WHERE id = 1")
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=match&sort=oldest", nil)
+	w := httptest.NewRecorder()
+
+	blog.Search(w, req)
+
+	body := w.Body.String()
+	older, newer := strings.Index(body, "Older Match"), strings.Index(body, "Newer Match")
+	if older == -1 || newer == -1 || older > newer {
+		t.Error("expected oldest result listed first")
+	}
+	if !strings.Contains(body, `<option value="oldest" selected>`) {
+		t.Error("expected oldest sort to be selected")
+	}
+}
+
+func TestSearch_NoResults(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Recent Post", "Content", true)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q="+url.QueryEscape("<b>nothing</b>"), nil)
+	w := httptest.NewRecorder()
+
+	blog.Search(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "No results for &ldquo;&lt;b&gt;nothing&lt;/b&gt;&rdquo;") {
+		t.Error("expected escaped no-results message")
+	}
+	if !strings.Contains(body, "Recent Post") {
+		t.Error("expected recent posts to be suggested")
+	}
+}
+
+func TestSearch_Results(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Matching Post", "Content", true)
+	createPost(blog.db, "Other Post", "Content", true)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=matching", nil)
+	w := httptest.NewRecorder()
+
+	blog.Search(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Matching Post") {
+		t.Error("expected matching post in results")
+	}
+	if strings.Contains(body, "Other Post") || strings.Contains(body, "No results") {
+		t.Error("expected only the matching post")
+	}
+}
+
+func TestSearch_Drafts(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Draft Match", "Content", false)
+	token, _ := createSession(blog.db, 1)
+
+	tests := []struct {
+		name          string
+		authenticated bool
+		wantDraft     bool
+	}{
+		{"anonymous", false, false},
+		{"authenticated", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/search?q=draft", nil)
+			if tt.authenticated {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			}
+			w := httptest.NewRecorder()
+
+			blog.Search(w, req)
+
+			if got := strings.Contains(w.Body.String(), "Draft Match"); got != tt.wantDraft {
+				t.Errorf("draft in results = %v, want %v", got, tt.wantDraft)
+			}
+		})
+	}
+}
+
+func TestDetail_DateLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		want    string
+	}{
+		{"default", "", "Posted on <time"},
+		{"configured", "Written <em>", "Written &lt;em&gt; <time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestBlog(t)
+			slug, _ := createPost(blog.db, "Dated Post", "Content", true)
+			setSetting(blog.db, "date_label", tt.setting)
+
+			req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+			req.SetPathValue("slug", slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("expected %q before the post date", tt.want)
+			}
+		})
+	}
+}
+
+func TestDetail_JSONLD(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Structured </script> Post", "Content", true)
+	createPost(blog.db, "Hidden Draft", "Content", false)
+	token, _ := createSession(blog.db, 1)
+
+	t.Run("published", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/structured-script-post", nil)
+		req.SetPathValue("slug", "structured-script-post")
+		w := httptest.NewRecorder()
+
+		blog.Detail(w, req)
+
+		body := w.Body.String()
+		start := strings.Index(body, `<script type="application/ld+json">`)
+		if start == -1 {
+			t.Fatal("expected JSON-LD block on published post")
+		}
+		start += len(`<script type="application/ld+json">`)
+		end := strings.Index(body[start:], "</script>")
+		if end == -1 {
+			t.Fatal("expected JSON-LD block to be closed")
+		}
+
+		var data map[string]any
+		if err := json.Unmarshal([]byte(body[start:start+end]), &data); err != nil {
+			t.Fatalf("parsing JSON-LD: %v", err)
+		}
+		if data["@type"] != "Article" {
+			t.Errorf("expected @type Article, got %v", data["@type"])
+		}
+		if data["headline"] != "Structured </script> Post" {
+			t.Errorf("expected headline to be the post title, got %v", data["headline"])
+		}
+	})
+
+	t.Run("draft", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/hidden-draft", nil)
+		req.SetPathValue("slug", "hidden-draft")
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		w := httptest.NewRecorder()
+
+		blog.Detail(w, req)
+
+		if strings.Contains(w.Body.String(), "application/ld+json") {
+			t.Error("expected no JSON-LD on draft")
+		}
+	})
+}
+
+func TestHome_Pagination(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	for i := 1; i <= postsPerPage+5; i++ {
+		createPost(blog.db, fmt.Sprintf("Post %d", i), "Content", true)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantNoIndex bool
+		wantPrev    string
+		wantNext    string
+	}{
+		{"first page", "", false, "", `<link rel="next" href="/?page=2">`},
+		{"second page", "?page=2", true, `<link rel="prev" href="/">`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			blog.Home(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			body := w.Body.String()
+			hasNoIndex := strings.Contains(body, `<meta name="robots" content="noindex,follow">`)
+			if hasNoIndex != tt.wantNoIndex {
+				t.Errorf("noindex meta present = %v, want %v", hasNoIndex, tt.wantNoIndex)
+			}
+			if tt.wantPrev != "" && !strings.Contains(body, tt.wantPrev) {
+				t.Errorf("expected %s", tt.wantPrev)
+			}
+			if tt.wantPrev == "" && strings.Contains(body, `rel="prev"`) {
+				t.Error("expected no prev link")
+			}
+			if tt.wantNext != "" && !strings.Contains(body, tt.wantNext) {
+				t.Errorf("expected %s", tt.wantNext)
+			}
+			if tt.wantNext == "" && strings.Contains(body, `rel="next"`) {
+				t.Error("expected no next link")
+			}
+		})
+	}
+}
+
+func TestHome_PageOutOfRange(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Only Post", "Content", true)
+
+	req := httptest.NewRequest(http.MethodGet, "/?page=3", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDetail_DraftPreviewBanner(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Draft Post", "Content", false)
+	createPost(blog.db, "Live Post", "Content", true)
+	token, _ := createSession(blog.db, 1)
+
+	tests := []struct {
+		slug       string
+		wantBanner bool
+	}{
+		{"draft-post", true},
+		{"live-post", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.slug, nil)
+			req.SetPathValue("slug", tt.slug)
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			hasBanner := strings.Contains(w.Body.String(), "draft preview")
+			if hasBanner != tt.wantBanner {
+				t.Errorf("draft banner present = %v, want %v", hasBanner, tt.wantBanner)
+			}
+		})
+	}
+}
+
+func TestHome_Excerpts(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Long Post", "Some **bold** words and a [link](https://example.com) that run on well past the cutoff", true)
+	setSetting(blog.db, "home_excerpt_length", "20")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<div class="excerpt"><p>Some <strong>bold</strong> words and a…</p></div>`) {
+		t.Error("expected trimmed, well-formed excerpt on home page")
+	}
+	if !strings.Contains(body, `class="read-more" href="/long-post#content"`) {
+		t.Error("expected read more link")
+	}
+}
+
+func TestDetail_ContentAnchor(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Anchored", "Content", true)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	w := httptest.NewRecorder()
+
+	blog.Detail(w, req)
+
+	if !strings.Contains(w.Body.String(), `<div class="post-content" id="content">`) {
+		t.Error("expected the content block to be the #content anchor target")
+	}
+}
+
+func TestHome_WrittenExcerpt(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Long Post", "The full content of the post", true)
+	updatePostMeta(blog.db, 1, PostMeta{Excerpt: "A summary & more"})
+	setSetting(blog.db, "home_excerpt_length", "20")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<div class="excerpt"><p>A summary &amp; more</p></div>`) {
+		t.Error("expected the written excerpt on home page")
+	}
+	if strings.Contains(body, "The full content") {
+		t.Error("expected the written excerpt to replace the trimmed content")
+	}
+}
+
+func TestExcerpt_DescriptionAndFeeds(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	slug, _ := createPost(blog.db, "Summarized", "The full content of the post", true)
+	updatePostMeta(blog.db, 1, PostMeta{Excerpt: "A short summary"})
+
+	req := httptest.NewRequest(http.MethodGet, "/"+slug, nil)
+	req.SetPathValue("slug", slug)
+	w := httptest.NewRecorder()
+	blog.Detail(w, req)
+	if !strings.Contains(w.Body.String(), `<meta name="description" content="A short summary">`) {
+		t.Error("expected excerpt as the meta description")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed", nil)
+	w = httptest.NewRecorder()
+	blog.Feed(w, req)
+	var feed rss
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("parsing feed: %v", err)
+	}
+	if got := feed.Channel.Items[0].Description; got != "A short summary" {
+		t.Errorf("expected excerpt as RSS description, got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/feed.atom", nil)
+	w = httptest.NewRecorder()
+	blog.AtomFeed(w, req)
+	if !strings.Contains(w.Body.String(), "<summary>A short summary</summary>") {
+		t.Error("expected excerpt as Atom summary")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"short", "hello world", 20, "hello world"},
+		{"word boundary", "an example sentence", 7, "an..."},
+		{"cut before space", "an example sentence", 10, "an example..."},
+		{"trailing punctuation", "first, second", 8, "first..."},
+		{"single long word", "supercalifragilistic", 5, "super..."},
+		{"multibyte", "héllo", 2, "h..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.s, tt.max); got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHome_ParagraphExcerpts(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Short Post", "Only paragraph", true)
+	createPost(blog.db, "Long Post", "First paragraph\n\nSecond paragraph\n\nThird paragraph", true)
+	setSetting(blog.db, "home_excerpt_mode", "paragraphs")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	blog.Home(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<div class="excerpt"><p>First paragraph</p></div>`) {
+		t.Error("expected only the first paragraph in the excerpt")
+	}
+	if strings.Contains(body, "Second paragraph") {
+		t.Error("expected later paragraphs to be left out")
+	}
+	if !strings.Contains(body, `class="read-more" href="/long-post#content"`) {
+		t.Error("expected read more link for the long post")
+	}
+	if strings.Contains(body, `class="read-more" href="/short-post#content"`) {
+		t.Error("expected no read more link when the whole post is shown")
+	}
+}
+
+func TestHome_Featured(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	setSetting(blog.db, "home_featured", "true")
+	setSetting(blog.db, "home_excerpt_mode", "paragraphs")
+
+	// No posts: nothing to feature
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	blog.Home(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `class="featured"`) {
+		t.Errorf("expected an empty home page without a featured post, got status %d", w.Code)
+	}
+
+	createPost(blog.db, "Older Post", "Older first\n\nOlder second", true)
+	createPost(blog.db, "Newest Post", "Newest first\n\nNewest second", true)
+
+	w = httptest.NewRecorder()
+	blog.Home(w, req)
+
+	body := w.Body.String()
+	featured, rest, ok := strings.Cut(body, `<ul class="published">`)
+	if !ok || !strings.Contains(featured, `<article class="featured">`) {
+		t.Fatal("expected a featured post above the list")
+	}
+	if !strings.Contains(featured, "Newest first") || !strings.Contains(featured, "Newest second") {
+		t.Error("expected the newest post in full")
+	}
+	if strings.Contains(rest, "Newest Post") {
+		t.Error("expected the featured post to be left out of the list")
+	}
+	if !strings.Contains(rest, "Older first") || strings.Contains(rest, "Older second") {
+		t.Error("expected the remaining posts to be shown compactly")
+	}
+}
+
+func TestHome_FeaturedWithPinnedPost(t *testing.T) {
+	blog := setupTestBlog(t)
+	setSetting(blog.db, "home_featured", "true")
+
+	createPost(blog.db, "Pinned Post", "Pinned content", true)
+	createPost(blog.db, "Newest Post", "Newest content", true)
+	blog.db.Exec("UPDATE posts SET pinned = 1, created_at = '2023-06-01 12:00:00' WHERE id = 1")
+
+	w := httptest.NewRecorder()
+	blog.Home(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	featured, rest, ok := strings.Cut(w.Body.String(), `<ul class="published">`)
+	if !ok || !strings.Contains(featured, "Newest content") {
+		t.Error("expected the newest post to be featured rather than the pinned one")
+	}
+	if !strings.Contains(rest, "Pinned Post") {
+		t.Error("expected the pinned post to stay in the list")
+	}
+}
+
+func TestExport_DateRange(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Old Post", "From last year", true)
+	createPost(blog.db, "New Post", "From this year", true)
+	createPost(blog.db, "Draft Post", "Still writing", false)
+	blog.db.Exec("UPDATE posts SET created_at = '2023-06-01 12:00:00' WHERE slug = 'old-post'")
+	blog.db.Exec("UPDATE posts SET created_at = '2024-03-15 23:30:00' WHERE slug IN ('new-post', 'draft-post')")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"no filter exports everything", "", []string{"draft-post.md", "new-post.md", "old-post.md"}},
+		{"from date", "?from=2024-01-01", []string{"draft-post.md", "new-post.md"}},
+		{"to date is inclusive", "?to=2024-03-15", []string{"draft-post.md", "new-post.md", "old-post.md"}},
+		{"closed range", "?from=2023-01-01&to=2023-12-31", []string{"old-post.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			blog.Export(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatalf("reading export: %v", err)
+			}
+			var got []string
+			for _, f := range zr.File {
+				got = append(got, f.Name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected files %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExport_TagFilter(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Go Post", "About Go", true)
+	createPost(blog.db, "Rust Post", "About Rust", true)
+	createPost(blog.db, "Untagged Post", "About nothing", true)
+	createPost(blog.db, "Go Draft", "Still writing about Go", false)
+	setPostTags(blog.db, 1, []string{"go"})
+	setPostTags(blog.db, 2, []string{"rust"})
+	setPostTags(blog.db, 4, []string{"go"})
+
+	req := httptest.NewRequest(http.MethodGet, "/export?tag=go", nil)
+	w := httptest.NewRecorder()
+
+	blog.Export(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	var got []string
+	for _, f := range zr.File {
+		got = append(got, f.Name)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "go-draft.md,go-post.md" {
+		t.Errorf("expected go-draft.md and go-post.md, got %v", got)
+	}
+}
+
+func TestExport_InvalidDate(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/export?from=last-week", nil)
+	w := httptest.NewRecorder()
+
+	blog.Export(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Published Post", "Content", true)
+	createPost(blog.db, "First Draft", "Content", false)
+	createPost(blog.db, "Second Draft", "Content", false)
+	createPost(blog.db, "Scheduled Post", "Content", true)
+	updatePost(blog.db, 4, "Scheduled Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(time.Hour)}, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	w := httptest.NewRecorder()
+
+	blog.Dashboard(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "1 published post, 1 scheduled, 2 drafts.") {
+		t.Error("expected post, scheduled and draft counts")
+	}
+	if !strings.Contains(body, `<a href="/edit/4">Scheduled Post</a>`) {
+		t.Error("expected scheduled posts to be listed")
+	}
+	if !strings.Contains(body, `<a href="/edit/2">First Draft</a>`) {
+		t.Error("expected drafts to link to the editor")
+	}
+	if !strings.Contains(body, `<a href="/new">New post</a>`) {
+		t.Error("expected a new post link")
+	}
+}
+
+func TestShortcut(t *testing.T) {
+	blog := setupTestBlog(t)
+	token, _ := createSession(blog.db, 1)
+	handler := blog.requireAuth(blog.Shortcut)
+
+	tests := []struct {
+		name         string
+		shortcut     string
+		token        string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"authenticated new", "new", token, http.StatusFound, "/new"},
+		{"unauthenticated new", "new", "", http.StatusSeeOther, "/login"},
+		{"unknown shortcut", "nope", token, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/go/"+tt.shortcut, nil)
+			req.SetPathValue("name", tt.shortcut)
+			if tt.token != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.token})
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("expected Location %q, got %q", tt.wantLocation, got)
+			}
+		})
+	}
+}
+
+func TestSettings_ExportImportRoundTrip(t *testing.T) {
+	source := setupTestBlog(t)
+	setSetting(source.db, "intro", "Hello from the backup")
+	setSetting(source.db, "theme", "sepia")
+
+	req := httptest.NewRequest(http.MethodGet, "/settings/export", nil)
+	w := httptest.NewRecorder()
+
+	source.ExportSettings(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	exported := w.Body.String()
+
+	target := setupTestBlog(t)
+	form := url.Values{}
+	form.Set("settings", exported)
+	req = httptest.NewRequest(http.MethodPost, "/settings/import", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	target.ImportSettings(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if intro, _ := getSetting(target.db, "intro"); intro != "Hello from the backup" {
+		t.Errorf("expected intro to round-trip, got %q", intro)
+	}
+	if theme, _ := getSetting(target.db, "theme"); theme != "sepia" {
+		t.Errorf("expected theme to round-trip, got %q", theme)
+	}
+}
+
+func TestSettings_ImportRejectsUnknownKeys(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	form := url.Values{}
+	form.Set("settings", `{"theme": "blue", "admin_password": "x"}`)
+	req := httptest.NewRequest(http.MethodPost, "/settings/import", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.ImportSettings(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if theme, _ := getSetting(blog.db, "theme"); theme != "" {
+		t.Errorf("expected nothing imported, got theme %q", theme)
+	}
+}
+
+func TestDetail_HreflangAlternates(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Hello", "Content", true)
+	createPost(blog.db, "Hola", "Contenido", true)
+	updatePostMeta(blog.db, 1, PostMeta{Language: "en"})
+	updatePostMeta(blog.db, 2, PostMeta{Language: "es", TranslationOf: 1})
+
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{"hello", `<link rel="alternate" hreflang="es" href="http://example.com/hola">`},
+		{"hola", `<link rel="alternate" hreflang="en" href="http://example.com/hello">`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.slug, nil)
+			req.Host = "example.com"
+			req.SetPathValue("slug", tt.slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("expected alternate %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestEdit_POST_MarkdownWarnings(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Broken", "Content", true)
+
+	form := url.Values{}
+	form.Set("title", "Broken")
+	form.Set("content", "Some **unclosed bold")
+	form.Set("action", "publish")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	req.SetPathValue("id", "1")
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	if location := w.Header().Get("Location"); location != "/edit/1?saved=1" {
+		t.Fatalf("expected redirect back to the editor, got %q", location)
+	}
+	if post, _ := getPostByID(blog.db, 1); post.Content != "Some **unclosed bold" {
+		t.Error("expected the post to be saved despite warnings")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/edit/1?saved=1", nil)
+	req.SetPathValue("id", "1")
+	w = httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Saved, but this post") || !strings.Contains(body, "A ** for bold text is never closed") {
+		t.Error("expected the warnings on the edit page")
+	}
+}
+
+func TestEdit_POST_AnnouncesPublication(t *testing.T) {
+	calls := make(chan announcement, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a announcement
+		json.NewDecoder(r.Body).Decode(&a)
+		calls <- a
+	}))
+	defer server.Close()
+
+	blog := setupTestBlog(t)
+	blog.client = server.Client()
+	setSetting(blog.db, "announce_webhook", server.URL)
+
+	createPost(blog.db, "Announced", "Content", false)
+
+	edit := func(action string) {
+		form := url.Values{}
+		form.Set("title", "Announced")
+		form.Set("content", "Content")
+		form.Set("action", action)
+
+		req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+		req.Host = "example.com"
+		req.SetPathValue("id", "1")
+		addCSRFToken(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		blog.Edit(w, req)
+	}
+
+	// Publishing the draft announces it
+	edit("publish")
+	select {
+	case a := <-calls:
+		if a.Title != "Announced" || a.URL != "http://example.com/announced" {
+			t.Errorf("unexpected announcement %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an announcement when the draft was published")
+	}
+
+	// Editing the already published post doesn't
+	edit("publish")
+	select {
+	case a := <-calls:
+		t.Errorf("expected no announcement for an edit, got %+v", a)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCreate_POST_AnnouncesScheduledPostWhenDue(t *testing.T) {
+	calls := make(chan announcement, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a announcement
+		json.NewDecoder(r.Body).Decode(&a)
+		calls <- a
+	}))
+	defer server.Close()
+
+	blog := setupTestBlog(t)
+	blog.client = server.Client()
+	setSetting(blog.db, "announce_webhook", server.URL)
+
+	form := url.Values{}
+	form.Set("title", "Later")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("publish_at", time.Now().Add(24*time.Hour).UTC().Format(dateTimeLocalLayout))
+	req := httptest.NewRequest(http.MethodPost, "/new", nil)
+	req.Host = "example.com"
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	blog.Create(httptest.NewRecorder(), req)
+
+	visit := func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "example.com"
+		blog.Home(httptest.NewRecorder(), req)
+	}
+
+	// Nothing is announced while the post is still scheduled
+	visit()
+	select {
+	case a := <-calls:
+		t.Fatalf("expected no announcement before the publish time, got %+v", a)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The first request after it goes live announces it, once
+	blog.db.Exec("UPDATE posts SET publish_at = '2000-01-01 00:00:00' WHERE slug = 'later'")
+	visit()
+	select {
+	case a := <-calls:
+		if a.Title != "Later" || a.URL != "http://example.com/later" {
+			t.Errorf("unexpected announcement %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an announcement once the scheduled post was due")
+	}
+
+	visit()
+	select {
+	case a := <-calls:
+		t.Errorf("expected the post to be announced only once, got %+v", a)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestEdit_POST_Date(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "First", "Content", true)
+	createPost(blog.db, "Second", "Content", true)
+	createPost(blog.db, "Third", "Content", true)
+
+	edit := func(date string) int {
+		form := url.Values{}
+		form.Set("title", "Third")
+		form.Set("content", "Content")
+		form.Set("action", "publish")
+		form.Set("date", date)
+
+		req := httptest.NewRequest(http.MethodPost, "/edit/3", nil)
+		req.SetPathValue("id", "3")
+		addCSRFToken(req, form)
+		req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		blog.Edit(w, req)
+		return w.Code
+	}
+
+	for _, date := range []string{"yesterday", "1850-01-01", "2999-01-01"} {
+		if code := edit(date); code != http.StatusBadRequest {
+			t.Errorf("date %q: expected status %d, got %d", date, http.StatusBadRequest, code)
+		}
+	}
+
+	if code := edit("2020-05-01"); code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, code)
+	}
+
+	posts, _ := getPublishedPosts(blog.db)
+	var titles []string
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Second,First,Third" {
+		t.Errorf("expected backdated post to sort last, got %s", got)
+	}
+	if got := posts[2].CreatedAt.Format("2006-01-02"); got != "2020-05-01" {
+		t.Errorf("expected date 2020-05-01, got %s", got)
+	}
+}
+
+func TestEdit_POST_ReplacesTags(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Tagged", "Content", true)
+	setPostTags(blog.db, 1, []string{"old", "kept"})
+
+	form := url.Values{}
+	form.Set("title", "Tagged")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("tags", "kept, new")
+
+	req := httptest.NewRequest(http.MethodPost, "/edit/1", nil)
+	req.SetPathValue("id", "1")
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Edit(w, req)
+
+	tags, _ := getPostTags(blog.db, 1)
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if got := strings.Join(names, ","); got != "kept,new" {
+		t.Errorf("expected tags kept,new, got %s", got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	createPost(blog.db, "Go and Web", "Content", true)
+	createPost(blog.db, "Just Go", "Content", true)
+	setPostTags(blog.db, 1, []string{"Go", "Web"})
+	setPostTags(blog.db, 2, []string{"Go"})
+
+	req := httptest.NewRequest(http.MethodGet, "/tags?t=go&t=web", nil)
+	w := httptest.NewRecorder()
+	blog.Tags(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Go and Web") || strings.Contains(body, "Just Go") {
+		t.Error("expected only the post with both tags")
+	}
+	if !strings.Contains(body, "Tagged &ldquo;Go&rdquo; and &ldquo;Web&rdquo;") {
+		t.Error("expected heading naming both tags")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/tags?t=go&t=web&match=any", nil)
+	w = httptest.NewRecorder()
+	blog.Tags(w, req)
+
+	body = w.Body.String()
+	if !strings.Contains(body, "Go and Web") || !strings.Contains(body, "Just Go") {
+		t.Error("expected posts with either tag")
+	}
+}
+
+func TestTag(t *testing.T) {
+	blog := setupTestBlog(t)
+
+	form := url.Values{}
+	form.Set("title", "Tagged Post")
+	form.Set("content", "Content")
+	form.Set("action", "publish")
+	form.Set("tags", "Go, Web")
+
+	req := httptest.NewRequest(http.MethodPost, "/new", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.Create(w, req)
+	createPost(blog.db, "Untagged Post", "Content", true)
+
+	req = httptest.NewRequest(http.MethodGet, "/tag/go", nil)
+	req.SetPathValue("slug", "go")
+	w = httptest.NewRecorder()
+
+	blog.Tag(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Tagged Post") || strings.Contains(body, "Untagged Post") {
+		t.Error("expected only the tagged post to be listed")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/tag/missing", nil)
+	req.SetPathValue("slug", "missing")
+	w = httptest.NewRecorder()
+
+	blog.Tag(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown tag, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAPIPosts(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Public", "Some **bold** text", true)
+	createPost(blog.db, "Hidden", "Draft content", false)
+	token, _ := createSession(blog.db, 1)
+
+	tests := []struct {
+		name   string
+		cookie bool
+		want   []string
+	}{
+		{"visitor", false, []string{"Public"}},
+		{"admin", true, []string{"Hidden", "Public"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			}
+			w := httptest.NewRecorder()
+
+			blog.APIPosts(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected Content-Type application/json, got %q", ct)
+			}
+
+			var posts []map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &posts); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var titles []string
+			for _, p := range posts {
+				for _, key := range []string{"id", "title", "slug", "created_at", "excerpt"} {
+					if _, ok := p[key]; !ok {
+						t.Errorf("expected key %q in %v", key, p)
+					}
+				}
+				titles = append(titles, p["title"].(string))
+			}
+			sort.Strings(titles)
+			if !slices.Equal(titles, tt.want) {
+				t.Errorf("expected titles %v, got %v", tt.want, titles)
+			}
+		})
+	}
+}
+
+func TestAPIPost(t *testing.T) {
+	blog := setupTestBlog(t)
+	publicSlug, _ := createPost(blog.db, "Public", "Some **bold** text", true)
+	draftSlug, _ := createPost(blog.db, "Hidden", "Draft content", false)
+	token, _ := createSession(blog.db, 1)
+
+	tests := []struct {
+		name       string
+		slug       string
+		cookie     bool
+		wantStatus int
+	}{
+		{"public post", publicSlug, false, http.StatusOK},
+		{"draft as visitor", draftSlug, false, http.StatusNotFound},
+		{"draft as admin", draftSlug, true, http.StatusOK},
+		{"missing slug", "missing", false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/posts/"+tt.slug, nil)
+			req.SetPathValue("slug", tt.slug)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+			}
+			w := httptest.NewRecorder()
+
+			blog.APIPost(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected Content-Type application/json, got %q", ct)
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if tt.wantStatus == http.StatusNotFound {
+				if body["error"] == nil {
+					t.Errorf("expected a JSON error, got %v", body)
+				}
+				return
+			}
+			if body["slug"] != tt.slug {
+				t.Errorf("expected slug %q, got %v", tt.slug, body["slug"])
+			}
+			if _, ok := body["content_html"].(string); !ok {
+				t.Errorf("expected content_html in %v", body)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/"+publicSlug, nil)
+	req.SetPathValue("slug", publicSlug)
+	w := httptest.NewRecorder()
+	blog.APIPost(w, req)
+	var post struct {
+		ContentHTML string `json:"content_html"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &post)
+	if !strings.Contains(post.ContentHTML, "<strong>bold</strong>") {
+		t.Errorf("expected rendered HTML content, got %q", post.ContentHTML)
+	}
+}
+
+func TestDetail_PrevNextLinks(t *testing.T) {
+	blog := setupTestBlog(t)
+	first, _ := createPost(blog.db, "First", "Content", true)
+	middle, _ := createPost(blog.db, "Middle", "Content", true)
+	last, _ := createPost(blog.db, "Last", "Content", true)
+	createPost(blog.db, "Draft", "Content", false)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-01-01 00:00:00' WHERE id = 1`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-02-01 00:00:00' WHERE id = 2`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-03-01 00:00:00' WHERE id = 3`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-04-01 00:00:00' WHERE id = 4`)
+
+	tests := []struct {
+		slug     string
+		wantPrev string
+		wantNext string
+	}{
+		{first, "", middle},
+		{middle, first, last},
+		{last, middle, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.slug, nil)
+			req.SetPathValue("slug", tt.slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			body := w.Body.String()
+			for _, link := range []struct{ slug, label string }{{tt.wantPrev, "Previous post"}, {tt.wantNext, "Next post"}} {
+				if link.slug == "" {
+					if strings.Contains(body, link.label) {
+						t.Errorf("expected no %q link", link.label)
+					}
+					continue
+				}
+				if !strings.Contains(body, `href="/`+link.slug+`"`) || !strings.Contains(body, link.label) {
+					t.Errorf("expected %q link to /%s", link.label, link.slug)
+				}
+			}
+		})
+	}
+}
+
+func TestTag_FeedAutodiscovery(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Tagged", "Content", true)
+	setPostTags(blog.db, 1, []string{"go"})
+
+	req := httptest.NewRequest(http.MethodGet, "/tag/go", nil)
+	req.SetPathValue("slug", "go")
+	w := httptest.NewRecorder()
+
+	blog.Tag(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<link rel="alternate" type="application/rss+xml" title="RSS" href="/tag/go/feed">`) {
+		t.Error("expected the tag feed to be advertised for autodiscovery")
+	}
+	if strings.Contains(body, `href="/feed.atom"`) {
+		t.Error("expected the global feeds to be left out of the tag page")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	blog.Home(w, req)
+	if !strings.Contains(w.Body.String(), `href="/feed"`) {
+		t.Error("expected the home page to keep the global feed link")
+	}
+}
+
+func TestTagFeed(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Tagged", "Content", true)
+	createPost(blog.db, "Untagged", "Content", true)
+	setPostTags(blog.db, 1, []string{"Go"})
+
+	req := httptest.NewRequest(http.MethodGet, "/tag/go/feed", nil)
+	req.SetPathValue("slug", "go")
+	w := httptest.NewRecorder()
+
+	blog.TagFeed(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var feed rss
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("decoding feed: %v", err)
+	}
+	if len(feed.Channel.Items) != 1 || feed.Channel.Items[0].Title != "Tagged" {
+		t.Errorf("expected only the tagged post, got %+v", feed.Channel.Items)
+	}
+	if !strings.HasSuffix(feed.Channel.Link, "/tag/go") || !strings.Contains(feed.Channel.Title, "Tagged Go") {
+		t.Errorf("expected a channel for the tag, got %q at %q", feed.Channel.Title, feed.Channel.Link)
+	}
+}
+
+func TestDetail_UpdatedOn(t *testing.T) {
+	blog := setupTestBlog(t)
+	edited, _ := createPost(blog.db, "Edited", "Content", true)
+	fresh, _ := createPost(blog.db, "Fresh", "Content", true)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-01-01 00:00:00', updated_at = '2024-03-05 10:00:00.000000' WHERE id = 1`)
+
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{edited, true},
+		{fresh, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.slug, nil)
+			req.SetPathValue("slug", tt.slug)
+			w := httptest.NewRecorder()
+
+			blog.Detail(w, req)
+
+			body := w.Body.String()
+			if got := strings.Contains(body, "Updated on"); got != tt.want {
+				t.Errorf("expected Updated on shown = %v", tt.want)
+			}
+			if tt.want && !strings.Contains(body, "March 5, 2024") {
+				t.Error("expected the update date")
+			}
+		})
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	blog := setupTestBlog(t)
+	createPost(blog.db, "Original Title", "Content", true)
+
+	feedBody := func() string {
+		w := httptest.NewRecorder()
+		blog.Feed(w, httptest.NewRequest(http.MethodGet, "/feed", nil))
+		return w.Body.String()
+	}
+	conditionalFeed := func(etag string) int {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		blog.Feed(w, req)
+		return w.Code
+	}
+	first := httptest.NewRecorder()
+	blog.Feed(first, httptest.NewRequest(http.MethodGet, "/feed", nil))
+	etag := first.Header().Get("ETag")
+
+	// A change made behind the post functions' backs isn't seen until purged
+	blog.db.Exec(`UPDATE posts SET title = 'Changed Title' WHERE id = 1`)
+	if !strings.Contains(feedBody(), "Original Title") {
+		t.Fatal("expected the feed to be served from the cache")
+	}
+	if code := conditionalFeed(etag); code != http.StatusNotModified {
+		t.Fatalf("expected status %d before the purge, got %d", http.StatusNotModified, code)
+	}
+
+	form := url.Values{}
+	req := httptest.NewRequest(http.MethodPost, "/settings/purge-cache", nil)
+	addCSRFToken(req, form)
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	blog.PurgeCache(w, req)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/settings?purged=1" {
+		t.Fatalf("expected redirect to /settings?purged=1, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if code := conditionalFeed(etag); code != http.StatusOK {
+		t.Errorf("expected status %d for the pre-purge ETag, got %d", http.StatusOK, code)
+	}
+	if !strings.Contains(feedBody(), "Changed Title") {
+		t.Error("expected the feed to be rebuilt from the database after a purge")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,14 +13,27 @@ import (
 
 type Blog struct {
 	db        *sql.DB
+	posts     PostStore
 	templates map[string]*template.Template
+	logins    *rateLimiter // failed logins per client IP
+	feeds     *rateLimiter // feed requests per client IP
+	client    *http.Client // for outgoing requests such as announcements
 }
 
-func NewBlog(db *sql.DB) *Blog {
+func NewBlog(db *sql.DB) (*Blog, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Blog{
 		db:        db,
-		templates: loadTemplates(),
-	}
+		posts:     sqlitePostStore{db: db},
+		templates: templates,
+		logins:    newRateLimiter(loginFailureWindow),
+		feeds:     newRateLimiter(feedRateWindow),
+		client:    &http.Client{Timeout: announceTimeout},
+	}, nil
 }
 
 func main() {
@@ -37,8 +51,10 @@ func main() {
 		log.Fatalf("initializing database: %v", err)
 	}
 
-	if err = seedDB(db); err != nil {
-		log.Fatalf("seeding database: %v", err)
+	if os.Getenv("SEED_POSTS") != "false" {
+		if err = seedDB(db, defaultSeedPosts, log.Default()); err != nil {
+			log.Fatalf("seeding database: %v", err)
+		}
 	}
 
 	if err = seedSettings(db); err != nil {
@@ -58,7 +74,10 @@ func main() {
 		}
 	}()
 
-	blog := NewBlog(db)
+	blog, err := NewBlog(db)
+	if err != nil {
+		log.Fatalf("loading templates: %v", err)
+	}
 
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
@@ -68,11 +87,24 @@ func main() {
 	http.HandleFunc("GET /{$}", blog.Home)
 	http.HandleFunc("GET /{slug}", blog.Detail)
 	http.HandleFunc("GET /feed", blog.Feed)
+	http.HandleFunc("GET /feed.atom", blog.AtomFeed)
+	http.HandleFunc("GET /feed.json", blog.JSONFeed)
+	http.HandleFunc("GET /sitemap.xml", blog.Sitemap)
+	http.HandleFunc("GET /robots.txt", blog.Robots)
+	http.HandleFunc("GET /search", blog.Search)
+	http.HandleFunc("GET /tag/{slug}", blog.Tag)
+	http.HandleFunc("GET /tag/{slug}/feed", blog.TagFeed)
+	http.HandleFunc("GET /tags", blog.Tags)
+	http.HandleFunc("GET /api/posts", blog.APIPosts)
+	http.HandleFunc("GET /api/posts/{slug}", blog.APIPost)
+	http.HandleFunc("GET /healthz", blog.Healthz)
 	http.HandleFunc("GET /admin", blog.Login)
 	http.HandleFunc("POST /admin", blog.Login)
+	http.HandleFunc("GET /login", blog.Login)
+	http.HandleFunc("POST /login", blog.Login)
 	http.HandleFunc("POST /logout", blog.Logout)
 
-	// Backward compatibility for old /post/{slug} URLs
+	// Backward compatibility for old /post/{slug} and /post/{id} URLs
 	http.HandleFunc("GET /post/{slug}", blog.LegacyPostRedirect)
 
 	// Protected routes
@@ -83,9 +115,18 @@ func main() {
 	http.HandleFunc("POST /edit/{id}", blog.requireAuth(blog.Edit))
 	http.HandleFunc("GET /delete/{id}", blog.requireAuth(blog.Delete))
 	http.HandleFunc("POST /delete/{id}", blog.requireAuth(blog.Delete))
+	http.HandleFunc("GET /trash", blog.requireAuth(blog.Trash))
+	http.HandleFunc("POST /trash/{id}/{action}", blog.requireAuth(blog.Trash))
 	http.HandleFunc("GET /settings", blog.requireAuth(blog.Settings))
 	http.HandleFunc("POST /settings", blog.requireAuth(blog.Settings))
+	http.HandleFunc("GET /settings/export", blog.requireAuth(blog.ExportSettings))
+	http.HandleFunc("POST /settings/import", blog.requireAuth(blog.ImportSettings))
+	http.HandleFunc("POST /settings/password", blog.requireAuth(blog.ChangePassword))
+	http.HandleFunc("POST /settings/purge-cache", blog.requireAuth(blog.PurgeCache))
+	http.HandleFunc("GET /export", blog.requireAuth(blog.Export))
+	http.HandleFunc("GET /dashboard", blog.requireAuth(blog.Dashboard))
+	http.HandleFunc("GET /go/{name}", blog.requireAuth(blog.Shortcut))
 
 	log.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", redirectHTTPS(blog.maintenance(http.DefaultServeMux))))
 }
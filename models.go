@@ -1,6 +1,9 @@
 package main
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type Post struct {
 	ID        int
@@ -9,6 +12,129 @@ type Post struct {
 	Content   string
 	Published bool
 	CreatedAt time.Time
+	// UpdatedAt is when the post was last saved, zero if it never has been.
+	UpdatedAt time.Time
+	// LastEditedBy is the user ID of whoever last saved the post.
+	LastEditedBy int
+	// PublishAt holds a published post back until that time. Zero means
+	// it is visible as soon as it is published.
+	PublishAt time.Time
+	// DeletedAt is when the post was moved to the trash, zero if it wasn't.
+	DeletedAt time.Time
+	PostMeta
+}
+
+// Version identifies the saved state of the post for edit conflict
+// detection. It is empty for posts without an updated_at.
+func (p Post) Version() string {
+	if p.UpdatedAt.IsZero() {
+		return ""
+	}
+	return p.UpdatedAt.UTC().Format(timestampLayout)
+}
+
+// IsEdited reports whether the post was saved again on a later day than it
+// is dated, which is when post pages mention the update.
+func (p Post) IsEdited() bool {
+	return p.UpdatedAt.After(p.CreatedAt) &&
+		p.UpdatedAt.UTC().Format(time.DateOnly) != p.CreatedAt.UTC().Format(time.DateOnly)
+}
+
+// LastModified is when the post last changed, for feeds and structured
+// data: UpdatedAt, or CreatedAt if that is later.
+func (p Post) LastModified() time.Time {
+	if p.UpdatedAt.After(p.CreatedAt) {
+		return p.UpdatedAt
+	}
+	return p.CreatedAt
+}
+
+// IsDraft reports whether the post is unpublished, so templates can style
+// drafts without negating Published.
+func (p Post) IsDraft() bool {
+	return !p.Published
+}
+
+// IsScheduled reports whether the post is published but waiting for its
+// PublishAt time.
+func (p Post) IsScheduled() bool {
+	return p.Published && p.PublishAt.After(time.Now())
+}
+
+// IsPublic reports whether visitors can see the post.
+func (p Post) IsPublic() bool {
+	return p.Published && !p.IsScheduled() && p.DeletedAt.IsZero()
+}
+
+// PostDates are the dates set from the edit form when saving a post.
+type PostDates struct {
+	// Created replaces the post's date when non-zero.
+	Created time.Time
+	// PublishAt schedules the post; zero publishes it immediately.
+	PublishAt time.Time
+}
+
+// Tag is a label posts can be filed under, listed at /tag/{slug}.
+type Tag struct {
+	ID   int
+	Name string
+	Slug string
+}
+
+// PostMeta holds optional per-post fields edited alongside the title and content.
+type PostMeta struct {
+	// CanonicalURL points at the original location of syndicated content.
+	// Empty means the post's own URL is canonical.
+	CanonicalURL string
+	// NoIndex asks search engines not to index the post, even when published.
+	NoIndex bool
+	// Language is the post's language code (e.g. "en", "pt-BR"), used for
+	// hreflang alternates. Empty means unspecified.
+	Language string
+	// TranslationOf is the ID of the post this one translates, or 0.
+	TranslationOf int
+	// OGImage overrides the image shown in link previews. Empty falls back
+	// to the post's first image, then the default_og_image setting.
+	OGImage string
+	// Excerpt is a hand-written plain text summary. Empty means summaries
+	// are cut from the content instead.
+	Excerpt string
+	// Template is the detail layout the post is shown with, one of
+	// detailTemplates. Empty means the default.
+	Template string
+	// AdminNotes are private notes shown only to signed-in users, never
+	// on public pages or in feeds.
+	AdminNotes string
+	// Pinned keeps the post at the top of the home page until PinUntil,
+	// or indefinitely when PinUntil is zero. Feeds ignore pins.
+	Pinned   bool
+	PinUntil time.Time
+	// ShowRelated lists related posts below the post. It defaults to true
+	// for new posts.
+	ShowRelated bool
+}
+
+// IsPinned reports whether the post is currently pinned.
+func (p Post) IsPinned() bool {
+	return p.Pinned && (p.PinUntil.IsZero() || p.PinUntil.After(time.Now()))
+}
+
+// DetailTemplate returns the layout to render the post with, falling back
+// to the default for an empty or unknown Template.
+func (p Post) DetailTemplate() string {
+	if slices.Contains(detailTemplates, p.Template) {
+		return p.Template
+	}
+	return detailTemplates[0]
+}
+
+// Summary returns the post's excerpt, or its content as plain text
+// truncated to about max bytes when it has none.
+func (p Post) Summary(max int) string {
+	if p.Excerpt != "" {
+		return p.Excerpt
+	}
+	return truncate(plainText(p.Content), max)
 }
 
 type Session struct {
@@ -2,24 +2,172 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
+// PostStore is the storage backend for posts. Handlers go through this
+// interface so alternate backends (or fakes in tests) can be swapped in.
+type PostStore interface {
+	GetPosts() ([]Post, error)
+	GetPublishedPosts() ([]Post, error)
+	GetByID(id int) (*Post, error)
+	GetBySlug(slug string) (*Post, error)
+	GetByOldSlug(slug string) (*Post, error)
+	Create(title, slug, content string, published bool) (string, error)
+	Update(id int, title, slug, content string, published bool, dates PostDates, editorID int) (string, error)
+	UpdateIfUnchanged(id int, version, title, slug, content string, published bool, dates PostDates, editorID int) (string, error)
+	UpdateMeta(id int, meta PostMeta) error
+	Delete(id int) error
+	GetDeleted() ([]Post, error)
+	Restore(id int) error
+	Purge(id int) error
+	EnsureUniqueSlug(slug string, excludeID int) (string, error)
+	FindRecentDuplicate(title, content string) (*Post, error)
+	Search(query, sort string, includeDrafts bool) ([]Post, error)
+	GetFeedPosts(limit int) ([]Post, error)
+	GetTranslations(postID int) ([]Post, error)
+	GetAdjacent(post Post, includeDrafts bool) (prev, next *Post, err error)
+	SetTags(postID int, names []string) error
+	GetTags(postID int) ([]Tag, error)
+	GetTag(slug string) (*Tag, error)
+	GetByTag(tagSlug string, includeDrafts bool) ([]Post, error)
+	GetByTags(tagSlugs []string, matchAll bool) ([]Post, error)
+	GetRelated(postID, limit int) ([]Post, error)
+}
+
+// sqlitePostStore implements PostStore using the package-level SQLite functions.
+type sqlitePostStore struct {
+	db *sql.DB
+}
+
+func (s sqlitePostStore) GetPosts() ([]Post, error) {
+	return getPosts(s.db)
+}
+
+func (s sqlitePostStore) GetPublishedPosts() ([]Post, error) {
+	return getPublishedPosts(s.db)
+}
+
+func (s sqlitePostStore) GetByID(id int) (*Post, error) {
+	return getPostByID(s.db, id)
+}
+
+func (s sqlitePostStore) GetBySlug(slug string) (*Post, error) {
+	return getPostBySlug(s.db, slug)
+}
+
+func (s sqlitePostStore) GetByOldSlug(slug string) (*Post, error) {
+	return getPostByOldSlug(s.db, slug)
+}
+
+func (s sqlitePostStore) Create(title, slug, content string, published bool) (string, error) {
+	return createPostWithSlug(s.db, title, slug, content, published)
+}
+
+func (s sqlitePostStore) Update(id int, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	return updatePost(s.db, id, title, slug, content, published, dates, editorID)
+}
+
+func (s sqlitePostStore) UpdateIfUnchanged(id int, version, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	return updatePostIfUnchanged(s.db, id, version, title, slug, content, published, dates, editorID)
+}
+
+func (s sqlitePostStore) UpdateMeta(id int, meta PostMeta) error {
+	return updatePostMeta(s.db, id, meta)
+}
+
+func (s sqlitePostStore) Delete(id int) error {
+	return deletePost(s.db, id)
+}
+
+func (s sqlitePostStore) GetDeleted() ([]Post, error) {
+	return getDeletedPosts(s.db)
+}
+
+func (s sqlitePostStore) Restore(id int) error {
+	return restorePost(s.db, id)
+}
+
+func (s sqlitePostStore) Purge(id int) error {
+	return purgePost(s.db, id)
+}
+
+func (s sqlitePostStore) EnsureUniqueSlug(slug string, excludeID int) (string, error) {
+	return ensureUniqueSlug(s.db, slug, excludeID)
+}
+
+func (s sqlitePostStore) FindRecentDuplicate(title, content string) (*Post, error) {
+	return findRecentDuplicate(s.db, title, content)
+}
+
+func (s sqlitePostStore) Search(query, sort string, includeDrafts bool) ([]Post, error) {
+	return searchPosts(s.db, query, sort, includeDrafts)
+}
+
+func (s sqlitePostStore) GetFeedPosts(limit int) ([]Post, error) {
+	return getFeedPosts(s.db, limit)
+}
+
+func (s sqlitePostStore) GetTranslations(postID int) ([]Post, error) {
+	return getTranslations(s.db, postID)
+}
+
+func (s sqlitePostStore) GetAdjacent(post Post, includeDrafts bool) (prev, next *Post, err error) {
+	return getAdjacentPosts(s.db, post, includeDrafts)
+}
+
+func (s sqlitePostStore) SetTags(postID int, names []string) error {
+	return setPostTags(s.db, postID, names)
+}
+
+func (s sqlitePostStore) GetTags(postID int) ([]Tag, error) {
+	return getPostTags(s.db, postID)
+}
+
+func (s sqlitePostStore) GetTag(slug string) (*Tag, error) {
+	return getTagBySlug(s.db, slug)
+}
+
+func (s sqlitePostStore) GetByTag(tagSlug string, includeDrafts bool) ([]Post, error) {
+	return getPostsByTag(s.db, tagSlug, includeDrafts)
+}
+
+func (s sqlitePostStore) GetByTags(tagSlugs []string, matchAll bool) ([]Post, error) {
+	return getPostsByTags(s.db, tagSlugs, matchAll)
+}
+
+func (s sqlitePostStore) GetRelated(postID, limit int) ([]Post, error) {
+	return getRelatedPosts(s.db, postID, limit)
+}
+
 // reservedSlugs contains paths that cannot be used as post slugs
 // to prevent collision with application routes.
 // NOTE: Keep in sync with routes defined in main.go
 var reservedSlugs = map[string]bool{
-	"admin":    true,
-	"logout":   true,
-	"feed":     true,
-	"new":      true,
-	"edit":     true,
-	"delete":   true,
-	"settings": true,
-	"static":   true,
-	"untitled": true, // fallback slug for empty titles
+	"admin":     true,
+	"api":       true,
+	"login":     true,
+	"logout":    true,
+	"feed":      true,
+	"go":        true,
+	"healthz":   true,
+	"new":       true,
+	"search":    true,
+	"edit":      true,
+	"export":    true,
+	"dashboard": true,
+	"delete":    true,
+	"settings":  true,
+	"static":    true,
+	"tag":       true,
+	"tags":      true,
+	"trash":     true,
+	"untitled":  true, // fallback slug for empty titles
 }
 
 // isReservedSlug checks if a slug conflicts with application routes
@@ -28,17 +176,18 @@ func isReservedSlug(slug string) bool {
 }
 
 // generateSlug creates a URL-friendly slug from a title.
-// Output contains only [a-z0-9-] characters, which are safe for URLs
-// without additional encoding.
-func generateSlug(title string) string {
+// Output contains only [a-z0-9-] characters plus any in extraChars, which
+// getSlugExtraChars limits to ones that are safe for URLs without
+// additional encoding.
+func generateSlug(title, extraChars string) string {
 	// Convert to lowercase
 	slug := strings.ToLower(title)
 
 	// Replace spaces with hyphens
 	slug = strings.ReplaceAll(slug, " ", "-")
 
-	// Remove all characters except alphanumeric and hyphens
-	reg := regexp.MustCompile(`[^a-z0-9-]`)
+	// Remove all characters except alphanumeric, hyphens and extraChars
+	reg := regexp.MustCompile(`[^a-z0-9-` + regexp.QuoteMeta(extraChars) + `]`)
 	slug = reg.ReplaceAllString(slug, "")
 
 	// Replace multiple consecutive hyphens with a single hyphen
@@ -48,50 +197,139 @@ func generateSlug(title string) string {
 	// Trim leading and trailing hyphens
 	slug = strings.Trim(slug, "-")
 
+	// Cap the length, without leaving a trailing hyphen
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+
 	return slug
 }
 
-// ensureUniqueSlug checks if a slug exists or is reserved, and appends a number suffix if needed
+var numericSlugRegex = regexp.MustCompile(`^[0-9-]+$`)
+
+// titleSlug derives a post's base slug from its title, falling back to
+// "untitled" and, when the prefix_numeric_slugs setting is on, prefixing
+// purely numeric slugs with "post-" so they can't be mistaken for dates or IDs.
+// When slug_date_prefix is on, the slug also starts with the post's
+// creation date, e.g. 2024-01-15-my-post.
+func titleSlug(db *sql.DB, title string, created time.Time) string {
+	slug := generateSlug(title, getSlugExtraChars(db))
+	if slug == "" {
+		slug = "untitled"
+	} else if numericSlugRegex.MatchString(slug) {
+		if prefix, _ := getSetting(db, "prefix_numeric_slugs"); prefix == "true" {
+			slug = "post-" + slug
+		}
+	}
+	if prefix, _ := getSetting(db, "slug_date_prefix"); prefix == "true" {
+		slug = created.UTC().Format("2006-01-02") + "-" + slug
+		if len(slug) > maxSlugLength {
+			slug = strings.TrimRight(slug[:maxSlugLength], "-")
+		}
+	}
+	return slug
+}
+
+// postSlug returns the base slug for a post: slug slugified when the author
+// set one, otherwise titleSlug. Manual slugs skip the date and numeric
+// prefixes but, like every slug, still go through ensureUniqueSlug.
+func postSlug(db *sql.DB, title, slug string, created time.Time) string {
+	if s := generateSlug(slug, getSlugExtraChars(db)); s != "" {
+		return s
+	}
+	return titleSlug(db, title, created)
+}
+
+const (
+	// maxSlugLength caps generated slugs, suffix included.
+	maxSlugLength = 100
+	// maxSlugSuffix is the highest numeric suffix ensureUniqueSlug tries
+	// before falling back to a random token.
+	maxSlugSuffix = 1000
+)
+
+// suffixSlug appends suffix to slug, trimming slug first so the result
+// stays within maxSlugLength.
+func suffixSlug(slug, suffix string) string {
+	if keep := maxSlugLength - len(suffix) - 1; len(slug) > keep {
+		slug = strings.TrimRight(slug[:keep], "-")
+	}
+	return slug + "-" + suffix
+}
+
+// ensureUniqueSlug checks if a slug exists or is reserved, and appends a number suffix if needed.
+// Posts in the trash keep their slugs unless the reuse_deleted_slugs setting is on.
 func ensureUniqueSlug(db *sql.DB, slug string, excludeID int) (string, error) {
 	if slug == "" {
 		return "", nil
 	}
 
+	taken := "slug = ?"
+	if reuse, _ := getSetting(db, "reuse_deleted_slugs"); reuse == "true" {
+		taken += " AND deleted_at IS NULL"
+	}
+
 	candidate := slug
 	suffix := 2
 
 	for {
 		// Check if slug is reserved (conflicts with app routes)
-		if isReservedSlug(candidate) {
-			candidate = fmt.Sprintf("%s-%d", slug, suffix)
-			suffix++
-			continue
+		if !isReservedSlug(candidate) {
+			// Check database for existing posts with this slug
+			var count int
+			var err error
+			if excludeID > 0 {
+				err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE `+taken+` AND id != ?`, candidate, excludeID).Scan(&count)
+			} else {
+				err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE `+taken, candidate).Scan(&count)
+			}
+			if err != nil {
+				return "", fmt.Errorf("checking slug uniqueness: %w", err)
+			}
+
+			if count == 0 {
+				return candidate, nil
+			}
 		}
 
-		// Check database for existing posts with this slug
-		var count int
-		var err error
-		if excludeID > 0 {
-			err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE slug = ? AND id != ?`, candidate, excludeID).Scan(&count)
-		} else {
-			err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE slug = ?`, candidate).Scan(&count)
-		}
-		if err != nil {
-			return "", fmt.Errorf("checking slug uniqueness: %w", err)
-		}
-
-		if count == 0 {
-			return candidate, nil
+		// Past maxSlugSuffix collisions, stop counting and try random tokens
+		if suffix > maxSlugSuffix {
+			token, err := generateToken()
+			if err != nil {
+				return "", fmt.Errorf("generating slug token: %w", err)
+			}
+			candidate = suffixSlug(slug, token[:8])
+			continue
 		}
 
-		candidate = fmt.Sprintf("%s-%d", slug, suffix)
+		candidate = suffixSlug(slug, fmt.Sprint(suffix))
 		suffix++
 	}
 }
 
-func getPosts(db *sql.DB) ([]Post, error) {
-	query := "SELECT id, title, slug, content, published, created_at FROM posts ORDER BY created_at DESC, id DESC"
-	rows, err := db.Query(query)
+// postColumns is the column list scanned by scanPost, in order.
+const postColumns = "id, title, slug, content, published, created_at, last_edited_by, canonical_url, noindex, language, translation_of, updated_at, og_image, publish_at, excerpt, template, admin_notes, pinned, pin_until, show_related, deleted_at"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row rowScanner) (Post, error) {
+	var post Post
+	var slug sql.NullString
+	var updatedAt, publishAt, pinUntil, deletedAt sql.NullTime
+	err := row.Scan(&post.ID, &post.Title, &slug, &post.Content, &post.Published, &post.CreatedAt, &post.LastEditedBy, &post.CanonicalURL, &post.NoIndex, &post.Language, &post.TranslationOf, &updatedAt, &post.OGImage, &publishAt, &post.Excerpt, &post.Template, &post.AdminNotes, &post.Pinned, &pinUntil, &post.ShowRelated, &deletedAt)
+	post.Slug = slug.String
+	post.UpdatedAt = updatedAt.Time
+	post.PublishAt = publishAt.Time
+	post.PinUntil = pinUntil.Time
+	post.DeletedAt = deletedAt.Time
+	return post, err
+}
+
+func queryPosts(db *sql.DB, query string, args ...any) ([]Post, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying posts: %w", err)
 	}
@@ -99,13 +337,10 @@ func getPosts(db *sql.DB) ([]Post, error) {
 
 	var posts []Post
 	for rows.Next() {
-		var post Post
-		var slug sql.NullString
-		err := rows.Scan(&post.ID, &post.Title, &slug, &post.Content, &post.Published, &post.CreatedAt)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scanning post: %w", err)
 		}
-		post.Slug = slug.String
 		posts = append(posts, post)
 	}
 
@@ -116,117 +351,481 @@ func getPosts(db *sql.DB) ([]Post, error) {
 	return posts, nil
 }
 
+// pinnedFirst orders currently pinned posts ahead of the rest on the home
+// page. A null pin_until pins indefinitely.
+const pinnedFirst = "(pinned = 1 AND (pin_until IS NULL OR pin_until > CURRENT_TIMESTAMP)) DESC, "
+
+func getPosts(db *sql.DB) ([]Post, error) {
+	return queryPosts(db, "SELECT "+postColumns+" FROM posts WHERE deleted_at IS NULL ORDER BY "+pinnedFirst+"created_at DESC, id DESC")
+}
+
+// publicPosts is the WHERE condition for posts visitors can see: published,
+// not scheduled for later and not in the trash. publish_at is stored in the
+// same format as CURRENT_TIMESTAMP so the two compare as text.
+const publicPosts = "published = 1 AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= CURRENT_TIMESTAMP)"
+
 func getPublishedPosts(db *sql.DB) ([]Post, error) {
-	query := "SELECT id, title, slug, content, published, created_at FROM posts WHERE published = 1 ORDER BY created_at DESC, id DESC"
-	rows, err := db.Query(query)
+	return queryPosts(db, "SELECT "+postColumns+" FROM posts WHERE "+publicPosts+" ORDER BY "+pinnedFirst+"created_at DESC, id DESC")
+}
+
+// getFeedPosts returns the limit most recent published posts in strict
+// reverse-chronological order for feeds. It is deliberately separate from
+// getPublishedPosts so that home page ordering rules (like pinning) never
+// reorder feed items. Results come from the feed cache when it has them.
+func getFeedPosts(db *sql.DB, limit int) ([]Post, error) {
+	cache := feedCacheFor(db)
+	if posts, ok := cache.get(limit); ok {
+		return posts, nil
+	}
+	posts, err := queryPosts(db, "SELECT "+postColumns+" FROM posts WHERE "+publicPosts+" ORDER BY created_at DESC, id DESC LIMIT ?", limit)
 	if err != nil {
-		return nil, fmt.Errorf("querying published posts: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	cache.put(limit, posts)
+	return posts, nil
+}
 
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		var slug sql.NullString
-		err := rows.Scan(&post.ID, &post.Title, &slug, &post.Content, &post.Published, &post.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("scanning post: %w", err)
-		}
-		post.Slug = slug.String
-		posts = append(posts, post)
-	}
+// feedCacheTTL is how long feed posts are served from memory. Saving a post
+// empties the cache right away, so the TTL only bounds how late a scheduled
+// post can reach the feeds.
+const feedCacheTTL = 5 * time.Minute
+
+// feedCache holds the results of recent getFeedPosts calls, keyed by limit,
+// so feed readers polling often don't query the database every time. Every
+// function here that writes posts invalidates it.
+type feedCache struct {
+	mu      sync.Mutex
+	entries map[int]feedCacheEntry
+	// generation counts purges, and purged is when the last one happened.
+	// Both feed into the feed validators so clients refetch after a purge.
+	generation uint64
+	purged     time.Time
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterating posts: %w", err)
+type feedCacheEntry struct {
+	posts   []Post
+	expires time.Time
+}
+
+// feedCaches maps each *sql.DB to its *feedCache.
+var feedCaches sync.Map
+
+func feedCacheFor(db *sql.DB) *feedCache {
+	cache, _ := feedCaches.LoadOrStore(db, &feedCache{entries: make(map[int]feedCacheEntry)})
+	return cache.(*feedCache)
+}
+
+// get returns the cached posts for limit, if they haven't expired.
+func (c *feedCache) get(limit int) ([]Post, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[limit]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
 	}
+	return e.posts, true
+}
 
-	return posts, nil
+func (c *feedCache) put(limit int, posts []Post) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[limit] = feedCacheEntry{posts: posts, expires: time.Now().Add(feedCacheTTL)}
 }
 
-func getPostByID(db *sql.DB, id int) (*Post, error) {
-	row := db.QueryRow(`
-		SELECT id, title, slug, content, published, created_at
+// invalidate empties the cache so the next feed request loads from the
+// database.
+func (c *feedCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
+
+// purge empties the cache and starts a new generation, for changes such as
+// settings that alter feed output without touching any post.
+func (c *feedCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.generation++
+	c.purged = time.Now()
+}
+
+// version returns the cache's generation and when it was last purged.
+func (c *feedCache) version() (uint64, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation, c.purged
+}
+
+// likeEscaper escapes LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// defaultSearchSort is used when the requested sort isn't in searchSorts.
+const defaultSearchSort = "newest"
+
+// searchSorts maps the allowed search sort options to their ORDER BY
+// clauses. Relevance ranks title matches above content-only matches.
+var searchSorts = map[string]string{
+	"relevance": "(title LIKE ?1 ESCAPE '\\') DESC, created_at DESC, id DESC",
+	"newest":    "created_at DESC, id DESC",
+	"oldest":    "created_at ASC, id ASC",
+}
+
+// searchPosts returns posts whose title or content contains query,
+// ordered by one of searchSorts. Drafts only match when includeDrafts is set.
+func searchPosts(db *sql.DB, query, sort string, includeDrafts bool) ([]Post, error) {
+	order, ok := searchSorts[sort]
+	if !ok {
+		order = searchSorts[defaultSearchSort]
+	}
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+	return queryPosts(db, `
+		SELECT `+postColumns+`
 		FROM posts
-		WHERE id = ?`, id)
+		WHERE deleted_at IS NULL AND (`+publicPosts+` OR ?2) AND (title LIKE ?1 ESCAPE '\' OR content LIKE ?1 ESCAPE '\')
+		ORDER BY `+order, pattern, includeDrafts)
+}
 
-	var post Post
-	var slug sql.NullString
-	err := row.Scan(&post.ID, &post.Title, &slug, &post.Content, &post.Published, &post.CreatedAt)
+func getPostByID(db *sql.DB, id int) (*Post, error) {
+	post, err := scanPost(db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("scanning post %d: %w", id, err)
 	}
-	post.Slug = slug.String
-
 	return &post, nil
 }
 
 func getPostBySlug(db *sql.DB, slug string) (*Post, error) {
-	row := db.QueryRow(`
-		SELECT id, title, slug, content, published, created_at
-		FROM posts
-		WHERE slug = ?`, slug)
-
-	var post Post
-	var slugVal sql.NullString
-	err := row.Scan(&post.ID, &post.Title, &slugVal, &post.Content, &post.Published, &post.CreatedAt)
+	post, err := scanPost(db.QueryRow("SELECT "+postColumns+" FROM posts WHERE slug = ? AND deleted_at IS NULL", slug))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("scanning post by slug %q: %w", slug, err)
 	}
-	post.Slug = slugVal.String
+	return &post, nil
+}
+
+// duplicatePostWindow is how far back findRecentDuplicate looks for a
+// matching post, long enough to catch an accidental double submit.
+const duplicatePostWindow = 5 * time.Minute
 
+// findRecentDuplicate returns a published post with the same title and
+// content created within duplicatePostWindow, or nil if there is none.
+func findRecentDuplicate(db *sql.DB, title, content string) (*Post, error) {
+	since := fmt.Sprintf("-%d seconds", int(duplicatePostWindow.Seconds()))
+	post, err := scanPost(db.QueryRow(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE published = 1 AND deleted_at IS NULL AND title = ? AND content = ? AND created_at >= datetime('now', ?)
+		ORDER BY id DESC
+		LIMIT 1`, title, content, since))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checking for duplicate post: %w", err)
+	}
 	return &post, nil
 }
 
 func createPost(db *sql.DB, title, content string, published bool) (string, error) {
-	slug := generateSlug(title)
-	if slug == "" {
-		slug = "untitled"
-	}
-	uniqueSlug, err := ensureUniqueSlug(db, slug, 0)
+	return createPostWithSlug(db, title, "", content, published)
+}
+
+// createPostWithSlug is createPost with a slug chosen by the author. An
+// empty slug derives one from the title as usual.
+func createPostWithSlug(db *sql.DB, title, slug, content string, published bool) (string, error) {
+	uniqueSlug, err := ensureUniqueSlug(db, postSlug(db, title, slug, time.Now()), 0)
 	if err != nil {
 		return "", fmt.Errorf("generating unique slug: %w", err)
 	}
 
+	// A new post's updated_at matches created_at, so it doesn't read as edited
+	created := time.Now().UTC()
 	_, err = db.Exec(`
-		INSERT INTO posts (title, slug, content, published)
-		VALUES (?, ?, ?, ?)`, title, uniqueSlug, content, published)
+		INSERT INTO posts (title, slug, content, published, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, title, uniqueSlug, content, published, created.Format(createdAtLayout), created.Truncate(time.Second).Format(timestampLayout))
 	if err != nil {
 		return "", fmt.Errorf("inserting post: %w", err)
 	}
+	feedCacheFor(db).invalidate()
 	return uniqueSlug, nil
 }
 
-func updatePost(db *sql.DB, id int, title, content string, published bool) (string, error) {
-	// Generate new slug from title
-	slug := generateSlug(title)
-	if slug == "" {
-		slug = "untitled"
+// timestampLayout is how updated_at is stored. It is fixed-width text with
+// microseconds so saves within the same second still get distinct versions
+// and stored values compare exactly against Post.Version.
+const timestampLayout = "2006-01-02 15:04:05.000000"
+
+// now returns the current time formatted for storage in updated_at.
+func now() string {
+	return time.Now().UTC().Format(timestampLayout)
+}
+
+// errEditConflict is returned by updatePostIfUnchanged when the post was
+// saved by someone else since the editor loaded it.
+var errEditConflict = errors.New("post was changed since it was loaded")
+
+// updatePost saves a post's title, content, published state and
+// schedule, recording editorID as the user who last edited it. A non-zero
+// dates.Created replaces the post's date, which also moves it in
+// date-ordered lists.
+func updatePost(db *sql.DB, id int, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	return savePost(db, id, "", title, slug, content, published, dates, editorID)
+}
+
+// updatePostIfUnchanged is updatePost with optimistic concurrency: the save
+// only happens if the post's Version still equals version, otherwise it
+// returns errEditConflict.
+func updatePostIfUnchanged(db *sql.DB, id int, version, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	return savePost(db, id, version, title, slug, content, published, dates, editorID)
+}
+
+// createdAtLayout is how created_at and publish_at are stored, matching
+// SQLite's CURRENT_TIMESTAMP so dates sort and compare correctly as text.
+const createdAtLayout = "2006-01-02 15:04:05"
+
+// savePost implements updatePost and updatePostIfUnchanged. An empty
+// version skips the conflict check, and an empty slug derives one from the
+// title.
+func savePost(db *sql.DB, id int, version, title, slug, content string, published bool, dates PostDates, editorID int) (string, error) {
+	// Date-prefixed slugs keep the post's date
+	created := dates.Created
+	keepDate := created.IsZero()
+	if keepDate {
+		if err := db.QueryRow("SELECT created_at FROM posts WHERE id = ?", id).Scan(&created); err != nil && err != sql.ErrNoRows {
+			return "", fmt.Errorf("loading post %d: %w", id, err)
+		}
 	}
-	uniqueSlug, err := ensureUniqueSlug(db, slug, id)
+
+	uniqueSlug, err := ensureUniqueSlug(db, postSlug(db, title, slug, created), id)
 	if err != nil {
 		return "", fmt.Errorf("generating unique slug: %w", err)
 	}
 
-	_, err = db.Exec(`
-		UPDATE posts
-		SET title = ?, slug = ?, content = ?, published = ?
-		WHERE id = ?`, title, uniqueSlug, content, published, id)
+	var oldSlug sql.NullString
+	if err := db.QueryRow("SELECT slug FROM posts WHERE id = ?", id).Scan(&oldSlug); err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("loading post %d: %w", id, err)
+	}
+
+	var publishAt any
+	if !dates.PublishAt.IsZero() {
+		publishAt = dates.PublishAt.UTC().Format(createdAtLayout)
+	}
+
+	set := "title = ?, slug = ?, content = ?, published = ?, last_edited_by = ?, updated_at = ?, publish_at = ?"
+	args := []any{title, uniqueSlug, content, published, editorID, now(), publishAt}
+	if !keepDate {
+		set += ", created_at = ?"
+		args = append(args, created.UTC().Format(createdAtLayout))
+	}
+	query := "UPDATE posts SET " + set + " WHERE id = ?"
+	args = append(args, id)
+	if version != "" {
+		query += " AND updated_at = ?"
+		args = append(args, version)
+	}
+
+	result, err := db.Exec(query, args...)
 	if err != nil {
 		return "", fmt.Errorf("updating post %d: %w", id, err)
 	}
+	if version != "" {
+		if n, err := result.RowsAffected(); err != nil {
+			return "", fmt.Errorf("updating post %d: %w", id, err)
+		} else if n == 0 {
+			return "", errEditConflict
+		}
+	}
+
+	feedCacheFor(db).invalidate()
+
+	if oldSlug.String != "" && oldSlug.String != uniqueSlug {
+		if err := addPostRedirect(db, oldSlug.String, uniqueSlug, id); err != nil {
+			return "", err
+		}
+	}
 	return uniqueSlug, nil
 }
 
+// addPostRedirect records that oldSlug now belongs to post id, which has
+// moved to newSlug, so links to the old slug keep working. A redirect from
+// newSlug itself is dropped since the post answers there directly again.
+func addPostRedirect(db *sql.DB, oldSlug, newSlug string, id int) error {
+	if _, err := db.Exec("INSERT OR REPLACE INTO post_redirects (slug, post_id) VALUES (?, ?)", oldSlug, id); err != nil {
+		return fmt.Errorf("adding redirect from %q: %w", oldSlug, err)
+	}
+	if _, err := db.Exec("DELETE FROM post_redirects WHERE slug = ?", newSlug); err != nil {
+		return fmt.Errorf("removing redirect from %q: %w", newSlug, err)
+	}
+	return nil
+}
+
+// getPostByOldSlug returns the post a former slug redirects to, or nil if
+// the slug never belonged to a post still outside the trash.
+func getPostByOldSlug(db *sql.DB, slug string) (*Post, error) {
+	post, err := scanPost(db.QueryRow(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE deleted_at IS NULL AND id = (SELECT post_id FROM post_redirects WHERE slug = ?)`, slug))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning post by old slug %q: %w", slug, err)
+	}
+	return &post, nil
+}
+
+// updatePostMeta saves the optional per-post fields set from the edit form.
+func updatePostMeta(db *sql.DB, id int, meta PostMeta) error {
+	var pinUntil any
+	if !meta.PinUntil.IsZero() {
+		pinUntil = meta.PinUntil.UTC().Format(createdAtLayout)
+	}
+	_, err := db.Exec(`
+		UPDATE posts
+		SET canonical_url = ?, noindex = ?, language = ?, translation_of = ?, og_image = ?, excerpt = ?, template = ?, admin_notes = ?, pinned = ?, pin_until = ?, show_related = ?
+		WHERE id = ?`, meta.CanonicalURL, meta.NoIndex, meta.Language, meta.TranslationOf, meta.OGImage, meta.Excerpt, meta.Template, meta.AdminNotes, meta.Pinned, pinUntil, meta.ShowRelated, id)
+	if err != nil {
+		return fmt.Errorf("updating post %d meta: %w", id, err)
+	}
+	feedCacheFor(db).invalidate()
+	return nil
+}
+
+// getTranslations returns the published posts in the same translation group
+// as postID, excluding postID itself. A group is an original post plus every
+// post whose translation_of points at it.
+func getTranslations(db *sql.DB, postID int) ([]Post, error) {
+	return queryPosts(db, `
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE `+publicPosts+` AND id != ?1 AND (
+			SELECT CASE WHEN translation_of > 0 THEN translation_of ELSE id END FROM posts WHERE id = ?1
+		) IN (id, translation_of)
+		ORDER BY id`, postID)
+}
+
+// getAdjacentPosts returns the posts just older (prev) and just newer (next)
+// than post by created_at, breaking ties on id. Drafts and scheduled posts
+// are only considered when includeDrafts is set. Either is nil at the end of
+// the list.
+func getAdjacentPosts(db *sql.DB, post Post, includeDrafts bool) (prev, next *Post, err error) {
+	created := post.CreatedAt.UTC().Format(createdAtLayout)
+	prev, err = adjacentPost(db, "created_at < ?1 OR (created_at = ?1 AND id < ?2)", "DESC", created, post.ID, includeDrafts)
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err = adjacentPost(db, "created_at > ?1 OR (created_at = ?1 AND id > ?2)", "ASC", created, post.ID, includeDrafts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prev, next, nil
+}
+
+// adjacentPost returns the first post matching cond in the given created_at
+// direction, or nil if there is none.
+func adjacentPost(db *sql.DB, cond, direction, created string, id int, includeDrafts bool) (*Post, error) {
+	post, err := scanPost(db.QueryRow(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE deleted_at IS NULL AND (`+publicPosts+` OR ?3) AND (`+cond+`)
+		ORDER BY created_at `+direction+`, id `+direction+`
+		LIMIT 1`, created, id, includeDrafts))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding post next to %d: %w", id, err)
+	}
+	return &post, nil
+}
+
+// deletePost moves a post to the trash. It stays out of every listing
+// until restorePost brings it back or purgePost removes it for good.
 func deletePost(db *sql.DB, id int) error {
-	_, err := db.Exec("DELETE FROM posts WHERE id = ?", id)
+	_, err := db.Exec("UPDATE posts SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC().Format(createdAtLayout), id)
 	if err != nil {
 		return fmt.Errorf("deleting post %d: %w", id, err)
 	}
+	feedCacheFor(db).invalidate()
+	return nil
+}
+
+// getDeletedPosts returns the posts in the trash, most recently deleted first.
+func getDeletedPosts(db *sql.DB) ([]Post, error) {
+	return queryPosts(db, "SELECT "+postColumns+" FROM posts WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC")
+}
+
+// restorePost takes a post back out of the trash, giving it a new slug if
+// its old one has been taken in the meantime.
+func restorePost(db *sql.DB, id int) error {
+	post, err := getPostByID(db, id)
+	if err != nil || post == nil {
+		return err
+	}
+
+	// With reuse_deleted_slugs on, another post may have taken the slug
+	// while this one was in the trash
+	slug, err := ensureUniqueSlug(db, post.Slug, id)
+	if err != nil {
+		return fmt.Errorf("restoring post %d: %w", id, err)
+	}
+
+	_, err = db.Exec("UPDATE posts SET deleted_at = NULL, slug = ? WHERE id = ?", slug, id)
+	if err != nil {
+		return fmt.Errorf("restoring post %d: %w", id, err)
+	}
+	feedCacheFor(db).invalidate()
+	return nil
+}
+
+// purgePost permanently removes a post with its tags and redirects. Unless the
+// disable_delete_archive setting is on, a copy of the post is first kept in
+// deleted_posts_archive so it can still be recovered by hand.
+func purgePost(db *sql.DB, id int) error {
+	// Read the setting before the transaction holds the connection
+	archive := isDeleteArchiveEnabled(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning purge of post %d: %w", id, err)
+	}
+	defer tx.Rollback()
+
+	if archive {
+		if err := archiveDeletedPost(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM posts WHERE id = ?", id); err != nil {
+		return fmt.Errorf("purging post %d: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", id); err != nil {
+		return fmt.Errorf("purging tags for post %d: %w", id, err)
+	}
+	if _, err := tx.Exec("DELETE FROM post_redirects WHERE post_id = ?", id); err != nil {
+		return fmt.Errorf("purging redirects for post %d: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing purge of post %d: %w", id, err)
+	}
+	feedCacheFor(db).invalidate()
+	return nil
+}
+
+// archiveDeletedPost copies a post into deleted_posts_archive.
+func archiveDeletedPost(tx *sql.Tx, id int) error {
+	_, err := tx.Exec(`
+		INSERT INTO deleted_posts_archive (post_id, title, slug, content, published, created_at, updated_at, deleted_at)
+		SELECT id, title, slug, content, published, created_at, updated_at, deleted_at
+		FROM posts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("archiving post %d: %w", id, err)
+	}
 	return nil
 }
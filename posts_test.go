@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestDB(t *testing.T) *Blog {
@@ -97,12 +102,55 @@ func TestGetPostByID_NotFound(t *testing.T) {
 	}
 }
 
+func TestCreatePostWithSlug(t *testing.T) {
+	blog := setupTestDB(t)
+
+	tests := []struct {
+		name  string
+		title string
+		slug  string
+		want  string
+	}{
+		{"differs from title", "A Long Title", "Short Link", "short-link"},
+		{"collides with existing", "Another Title", "short-link", "short-link-2"},
+		{"reserved", "Admin Tips", "admin", "admin-2"},
+		{"empty uses title", "From The Title", "", "from-the-title"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug, err := createPostWithSlug(blog.db, tt.title, tt.slug, "Content", true)
+			if err != nil {
+				t.Fatalf("createPostWithSlug() error: %v", err)
+			}
+			if slug != tt.want {
+				t.Errorf("expected slug %q, got %q", tt.want, slug)
+			}
+		})
+	}
+}
+
+func TestUpdatePost_ManualSlug(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Taken", "Content", true)
+	createPost(blog.db, "Original", "Content", true)
+
+	slug, err := updatePost(blog.db, 2, "Renamed", "taken", "Content", true, PostDates{}, 1)
+	if err != nil {
+		t.Fatalf("updatePost() error: %v", err)
+	}
+	if slug != "taken-2" {
+		t.Errorf("expected colliding manual slug to be suffixed, got %q", slug)
+	}
+}
+
 func TestUpdatePost(t *testing.T) {
 	blog := setupTestDB(t)
 
 	createPost(blog.db, "Original", "Original content", true)
 
-	slug, err := updatePost(blog.db, 1, "Updated", "Updated content", true)
+	slug, err := updatePost(blog.db, 1, "Updated", "", "Updated content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -120,6 +168,27 @@ func TestUpdatePost(t *testing.T) {
 	}
 }
 
+func TestUpdatePost_BumpsUpdatedAt(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Post", "Content", true)
+	post, _ := getPostByID(blog.db, 1)
+	if !post.UpdatedAt.Equal(post.CreatedAt) || post.IsEdited() {
+		t.Fatalf("expected a new post's updated_at to equal created_at, got %v and %v", post.UpdatedAt, post.CreatedAt)
+	}
+
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-01-01 00:00:00' WHERE id = 1`)
+	updatePost(blog.db, 1, "Post", "", "Edited content", true, PostDates{}, 1)
+
+	post, _ = getPostByID(blog.db, 1)
+	if !post.UpdatedAt.After(post.CreatedAt) || !post.IsEdited() {
+		t.Errorf("expected updatePost to bump updated_at past created_at, got %v and %v", post.UpdatedAt, post.CreatedAt)
+	}
+	if !post.LastModified().Equal(post.UpdatedAt) {
+		t.Errorf("expected LastModified to be updated_at, got %v", post.LastModified())
+	}
+}
+
 func TestDeletePost(t *testing.T) {
 	blog := setupTestDB(t)
 
@@ -130,12 +199,169 @@ func TestDeletePost(t *testing.T) {
 		t.Fatalf("deletePost() error: %v", err)
 	}
 
-	post, _ := getPostByID(blog.db, 1)
-	if post != nil {
+	posts, _ := getPosts(blog.db)
+	if len(posts) != 0 {
 		t.Error("expected post to be deleted")
 	}
 }
 
+func TestRestorePost(t *testing.T) {
+	blog := setupTestDB(t)
+
+	slug, _ := createPost(blog.db, "Restore Me", "Content", true)
+	deletePost(blog.db, 1)
+
+	if post, _ := getPostBySlug(blog.db, slug); post != nil {
+		t.Fatal("expected deleted post to be hidden by slug")
+	}
+	if posts, _ := getPublishedPosts(blog.db); len(posts) != 0 {
+		t.Fatalf("expected deleted post left out of published posts, got %d", len(posts))
+	}
+
+	if err := restorePost(blog.db, 1); err != nil {
+		t.Fatalf("restorePost() error: %v", err)
+	}
+
+	post, _ := getPostBySlug(blog.db, slug)
+	if post == nil || !post.DeletedAt.IsZero() {
+		t.Fatal("expected post to be restored")
+	}
+	if trash, _ := getDeletedPosts(blog.db); len(trash) != 0 {
+		t.Errorf("expected empty trash, got %d posts", len(trash))
+	}
+}
+
+func TestCreatePost_TrashedSlug(t *testing.T) {
+	tests := []struct {
+		name  string
+		reuse string
+		want  string
+	}{
+		{"kept by default", "", "taken-2"},
+		{"reused when enabled", "true", "taken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestDB(t)
+			setSetting(blog.db, "reuse_deleted_slugs", tt.reuse)
+			createPost(blog.db, "Taken", "Content", true)
+			deletePost(blog.db, 1)
+
+			slug, err := createPost(blog.db, "Taken", "Content", true)
+			if err != nil {
+				t.Fatalf("createPost() error: %v", err)
+			}
+			if slug != tt.want {
+				t.Errorf("expected slug %q, got %q", tt.want, slug)
+			}
+		})
+	}
+}
+
+func TestRestorePost_SlugTaken(t *testing.T) {
+	blog := setupTestDB(t)
+	setSetting(blog.db, "reuse_deleted_slugs", "true")
+
+	createPost(blog.db, "Taken", "Content", true)
+	deletePost(blog.db, 1)
+	createPost(blog.db, "Taken", "Content", true)
+
+	if err := restorePost(blog.db, 1); err != nil {
+		t.Fatalf("restorePost() error: %v", err)
+	}
+
+	restored, _ := getPostByID(blog.db, 1)
+	if restored.Slug != "taken-2" || !restored.DeletedAt.IsZero() {
+		t.Errorf("expected restored post moved to taken-2, got %q", restored.Slug)
+	}
+	if post, _ := getPostBySlug(blog.db, "taken"); post == nil || post.ID != 2 {
+		t.Error("expected the new post to keep its slug")
+	}
+}
+
+func TestPurgePost(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Purge Me", "Content", true)
+	setPostTags(blog.db, 1, []string{"go"})
+	deletePost(blog.db, 1)
+
+	if err := purgePost(blog.db, 1); err != nil {
+		t.Fatalf("purgePost() error: %v", err)
+	}
+
+	if post, _ := getPostByID(blog.db, 1); post != nil {
+		t.Error("expected post to be gone")
+	}
+	if tags, _ := getPostTags(blog.db, 1); len(tags) != 0 {
+		t.Errorf("expected tags to be purged, got %v", tags)
+	}
+}
+
+func TestPurgePost_Archive(t *testing.T) {
+	tests := []struct {
+		name    string
+		disable string
+		want    int
+	}{
+		{"archived by default", "", 1},
+		{"archive disabled", "true", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestDB(t)
+			setSetting(blog.db, "disable_delete_archive", tt.disable)
+			createPost(blog.db, "Archive Me", "Precious content", true)
+			deletePost(blog.db, 1)
+
+			if err := purgePost(blog.db, 1); err != nil {
+				t.Fatalf("purgePost() error: %v", err)
+			}
+
+			var count int
+			blog.db.QueryRow("SELECT COUNT(*) FROM deleted_posts_archive WHERE post_id = 1 AND content = 'Precious content' AND slug = 'archive-me' AND deleted_at IS NOT NULL").Scan(&count)
+			if count != tt.want {
+				t.Errorf("expected %d archive rows, got %d", tt.want, count)
+			}
+		})
+	}
+}
+
+func TestPostRedirects(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "First", "Content", true)
+	updatePost(blog.db, 1, "Second", "", "Content", true, PostDates{}, 1)
+	updatePost(blog.db, 1, "Third", "", "Content", true, PostDates{}, 1)
+
+	for _, slug := range []string{"first", "second"} {
+		post, err := getPostByOldSlug(blog.db, slug)
+		if err != nil {
+			t.Fatalf("getPostByOldSlug() error: %v", err)
+		}
+		if post == nil || post.Slug != "third" {
+			t.Errorf("expected %q to redirect to third, got %v", slug, post)
+		}
+	}
+
+	// Renaming back drops the redirect from the slug the post now uses
+	updatePost(blog.db, 1, "First", "", "Content", true, PostDates{}, 1)
+	var count int
+	blog.db.QueryRow("SELECT COUNT(*) FROM post_redirects WHERE slug = 'first'").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected no redirect from the current slug, got %d", count)
+	}
+
+	deletePost(blog.db, 1)
+	purgePost(blog.db, 1)
+	blog.db.QueryRow("SELECT COUNT(*) FROM post_redirects").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected redirects purged with the post, got %d", count)
+	}
+}
+
 func TestDeletePost_NonExistent(t *testing.T) {
 	blog := setupTestDB(t)
 
@@ -166,6 +392,67 @@ func TestGetPublishedPosts_ExcludesDrafts(t *testing.T) {
 	}
 }
 
+func TestGetPublishedPosts_Scheduled(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Future Post", "Content", true)
+	createPost(blog.db, "Due Post", "Content", true)
+	future := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	updatePost(blog.db, 1, "Future Post", "", "Content", true, PostDates{PublishAt: future}, 1)
+	updatePost(blog.db, 2, "Due Post", "", "Content", true, PostDates{PublishAt: time.Now().Add(-time.Hour)}, 1)
+
+	published, err := getPublishedPosts(blog.db)
+	if err != nil {
+		t.Fatalf("getPublishedPosts() error: %v", err)
+	}
+	if len(published) != 1 || published[0].Title != "Due Post" {
+		t.Fatalf("expected only 'Due Post', got %+v", published)
+	}
+
+	post, _ := getPostByID(blog.db, 1)
+	if !post.PublishAt.Equal(future) {
+		t.Errorf("expected publish_at %v, got %v", future, post.PublishAt)
+	}
+	if !post.IsScheduled() || post.IsPublic() {
+		t.Error("expected future post to be scheduled and not public")
+	}
+}
+
+func TestGetPublishedPosts_Pinned(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Expired Pin", "Content", true)
+	createPost(blog.db, "Pinned Forever", "Content", true)
+	createPost(blog.db, "Newest", "Content", true)
+	// Same-second created_at values tie, and ties fall back to id order
+	updatePostMeta(blog.db, 1, PostMeta{Pinned: true, PinUntil: time.Now().Add(-time.Hour)})
+	updatePostMeta(blog.db, 2, PostMeta{Pinned: true})
+
+	posts, err := getPublishedPosts(blog.db)
+	if err != nil {
+		t.Fatalf("getPublishedPosts() error: %v", err)
+	}
+	var got []string
+	for _, post := range posts {
+		got = append(got, post.Title)
+	}
+	want := []string{"Pinned Forever", "Newest", "Expired Pin"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected order %v, got %v", want, got)
+	}
+	if posts[2].IsPinned() {
+		t.Error("expected a pin past its pin_until to have expired")
+	}
+
+	feed, err := getFeedPosts(blog.db, maxFeedItems)
+	if err != nil {
+		t.Fatalf("getFeedPosts() error: %v", err)
+	}
+	if feed[0].Title != "Newest" {
+		t.Errorf("expected the feed to ignore pins, got %q first", feed[0].Title)
+	}
+}
+
 func TestGetPosts_IncludesDrafts(t *testing.T) {
 	blog := setupTestDB(t)
 
@@ -201,7 +488,7 @@ func TestUpdatePost_PublishDraft(t *testing.T) {
 
 	createPost(blog.db, "Draft", "Content", false)
 
-	_, err := updatePost(blog.db, 1, "Draft", "Content", true)
+	_, err := updatePost(blog.db, 1, "Draft", "", "Content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -217,7 +504,7 @@ func TestUpdatePost_UnpublishPost(t *testing.T) {
 
 	createPost(blog.db, "Published", "Content", true)
 
-	_, err := updatePost(blog.db, 1, "Published", "Content", false)
+	_, err := updatePost(blog.db, 1, "Published", "", "Content", false, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -250,7 +537,7 @@ func TestGenerateSlug(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := generateSlug(tt.title)
+			result := generateSlug(tt.title, "")
 			if result != tt.expected {
 				t.Errorf("generateSlug(%q) = %q, want %q", tt.title, result, tt.expected)
 			}
@@ -258,6 +545,50 @@ func TestGenerateSlug(t *testing.T) {
 	}
 }
 
+func TestGenerateSlug_ExtraChars(t *testing.T) {
+	if got := generateSlug("my_post", "_"); got != "my_post" {
+		t.Errorf("generateSlug with _ allowed = %q, want %q", got, "my_post")
+	}
+	if got := generateSlug("my_post", ""); got != "mypost" {
+		t.Errorf("generateSlug by default = %q, want %q", got, "mypost")
+	}
+}
+
+func TestTitleSlug_ExtraCharsSetting(t *testing.T) {
+	blog := setupTestDB(t)
+
+	if got := titleSlug(blog.db, "my_post.v2", time.Now()); got != "mypostv2" {
+		t.Errorf("titleSlug() by default = %q, want %q", got, "mypostv2")
+	}
+
+	// Characters outside slugSafeChars are dropped from the setting
+	setSetting(blog.db, "slug_extra_chars", "_/")
+	if got := titleSlug(blog.db, "my_post/v2", time.Now()); got != "my_postv2" {
+		t.Errorf("titleSlug() with _ allowed = %q, want %q", got, "my_postv2")
+	}
+}
+
+func TestPostSlug_NoDots(t *testing.T) {
+	blog := setupTestDB(t)
+	setSetting(blog.db, "slug_extra_chars", "_.~")
+
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{"robots.txt", "robotstxt"},
+		{"sitemap.xml", "sitemapxml"},
+		{"feed.json", "feedjson"},
+		{"feed.atom", "feedatom"},
+		{"..", "dot-post"},
+	}
+	for _, tt := range tests {
+		if got := postSlug(blog.db, "Dot Post", tt.slug, time.Now()); got != tt.want {
+			t.Errorf("postSlug(%q) = %q, want %q", tt.slug, got, tt.want)
+		}
+	}
+}
+
 func TestGenerateSlug_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -273,7 +604,7 @@ func TestGenerateSlug_EdgeCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := generateSlug(tt.title)
+			result := generateSlug(tt.title, "")
 			if result != tt.expected {
 				t.Errorf("generateSlug(%q) = %q, want %q", tt.title, result, tt.expected)
 			}
@@ -463,7 +794,7 @@ func TestUpdatePost_UpdatesSlug(t *testing.T) {
 
 	createPost(blog.db, "Original Title", "Content", true)
 
-	newSlug, err := updatePost(blog.db, 1, "New Title", "Content", true)
+	newSlug, err := updatePost(blog.db, 1, "New Title", "", "Content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -484,7 +815,7 @@ func TestUpdatePost_SameTitleKeepsSlug(t *testing.T) {
 	createPost(blog.db, "My Title", "Content", true)
 
 	// Update with same title - slug should remain unchanged
-	newSlug, err := updatePost(blog.db, 1, "My Title", "Updated content", true)
+	newSlug, err := updatePost(blog.db, 1, "My Title", "", "Updated content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -562,7 +893,7 @@ func TestUpdatePost_EmptySlugFallback(t *testing.T) {
 
 	// Update to a title that produces empty slug
 	// Since "untitled" is reserved, gets "untitled-2"
-	newSlug, err := updatePost(blog.db, 1, "!@#$%", "Updated content", true)
+	newSlug, err := updatePost(blog.db, 1, "!@#$%", "", "Updated content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -588,7 +919,7 @@ func TestUpdatePost_EmptySlugFallback_WhenUntitledExists(t *testing.T) {
 
 	// Update second post to a title that produces empty slug
 	// Should get "untitled-3" since "untitled" is reserved and "untitled-2" exists
-	newSlug, err := updatePost(blog.db, 2, "^&*()", "Updated content", true)
+	newSlug, err := updatePost(blog.db, 2, "^&*()", "", "Updated content", true, PostDates{}, 1)
 	if err != nil {
 		t.Fatalf("updatePost() error: %v", err)
 	}
@@ -602,3 +933,454 @@ func TestUpdatePost_EmptySlugFallback_WhenUntitledExists(t *testing.T) {
 		t.Errorf("expected post.Slug 'untitled-3', got %q", post.Slug)
 	}
 }
+
+func TestEnsureUniqueSlug_MaxLength(t *testing.T) {
+	blog := setupTestDB(t)
+
+	title := strings.Repeat("long ", 50)
+	first, err := createPost(blog.db, title, "Content", true)
+	if err != nil {
+		t.Fatalf("createPost() error: %v", err)
+	}
+	if len(first) > maxSlugLength {
+		t.Errorf("expected slug of at most %d characters, got %d", maxSlugLength, len(first))
+	}
+
+	second, err := createPost(blog.db, title, "Content", true)
+	if err != nil {
+		t.Fatalf("createPost() error: %v", err)
+	}
+	if len(second) > maxSlugLength {
+		t.Errorf("expected suffixed slug of at most %d characters, got %d", maxSlugLength, len(second))
+	}
+	if !strings.HasSuffix(second, "-2") || strings.Contains(second, "--") {
+		t.Errorf("expected a clean -2 suffix, got %q", second)
+	}
+	if second == first {
+		t.Error("expected the suffixed slug to be unique")
+	}
+}
+
+func TestSuffixSlug(t *testing.T) {
+	tests := []struct {
+		name   string
+		slug   string
+		suffix string
+		want   string
+	}{
+		{"short slug untouched", "hello", "2", "hello-2"},
+		{"trims base to fit", strings.Repeat("a", maxSlugLength), "1000", strings.Repeat("a", maxSlugLength-5) + "-1000"},
+		{"drops hyphen at cut", strings.Repeat("ab-", 40), "100", strings.Repeat("ab-", 31) + "ab-100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suffixSlug(tt.slug, tt.suffix)
+			if got != tt.want {
+				t.Errorf("suffixSlug() = %q, want %q", got, tt.want)
+			}
+			if len(got) > maxSlugLength {
+				t.Errorf("expected at most %d characters, got %d", maxSlugLength, len(got))
+			}
+		})
+	}
+}
+
+func TestCreatePost_SlugDatePrefix(t *testing.T) {
+	blog := setupTestDB(t)
+	setSetting(blog.db, "slug_date_prefix", "true")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	slug, err := createPost(blog.db, "My Post", "Content", true)
+	if err != nil {
+		t.Fatalf("createPost() error: %v", err)
+	}
+	if want := today + "-my-post"; slug != want {
+		t.Errorf("expected slug %q, got %q", want, slug)
+	}
+
+	// Same title, same day: still unique
+	slug, _ = createPost(blog.db, "My Post", "Content", true)
+	if want := today + "-my-post-2"; slug != want {
+		t.Errorf("expected slug %q, got %q", want, slug)
+	}
+
+	// Reserved words are safe behind the date
+	slug, _ = createPost(blog.db, "Settings", "Content", true)
+	if want := today + "-settings"; slug != want {
+		t.Errorf("expected slug %q, got %q", want, slug)
+	}
+
+	// Editing keeps the creation date, not the edit date
+	blog.db.Exec("UPDATE posts SET created_at = '2020-02-03 10:00:00' WHERE id = 1")
+	slug, _ = updatePost(blog.db, 1, "Renamed", "", "Content", true, PostDates{}, 1)
+	if want := "2020-02-03-renamed"; slug != want {
+		t.Errorf("expected slug %q, got %q", want, slug)
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Gardening Notes", "Tomatoes and basil", true)
+	createPost(blog.db, "Cooking", "A basil pesto recipe", true)
+	createPost(blog.db, "Basil Draft", "Unfinished", false)
+	createPost(blog.db, "Percentages", "100% literal", true)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"matches title and content", "basil", []string{"Cooking", "Gardening Notes"}},
+		{"drafts excluded", "unfinished", nil},
+		{"wildcards are literal", "%", []string{"Percentages"}},
+		{"no match", "zucchini", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := searchPosts(blog.db, tt.query, "", false)
+			if err != nil {
+				t.Fatalf("searchPosts() error: %v", err)
+			}
+			var titles []string
+			for _, p := range posts {
+				titles = append(titles, p.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("searchPosts(%q) = %v, want %v", tt.query, titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPosts_Sort(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Old Basil", "First", true)
+	createPost(blog.db, "Middle", "Mentions basil", true)
+	createPost(blog.db, "New Basil", "Last", true)
+	blog.db.Exec("UPDATE posts SET created_at = datetime('now', '-2 days') WHERE id = 1")
+	blog.db.Exec("UPDATE posts SET created_at = datetime('now', '-1 days') WHERE id = 2")
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"newest", []string{"New Basil", "Middle", "Old Basil"}},
+		{"oldest", []string{"Old Basil", "Middle", "New Basil"}},
+		{"relevance", []string{"New Basil", "Old Basil", "Middle"}},
+		{"bogus", []string{"New Basil", "Middle", "Old Basil"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			posts, err := searchPosts(blog.db, "basil", tt.sort, false)
+			if err != nil {
+				t.Fatalf("searchPosts() error: %v", err)
+			}
+			var titles []string
+			for _, p := range posts {
+				titles = append(titles, p.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("searchPosts(sort=%q) = %v, want %v", tt.sort, titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatePost_NumericSlugPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		title   string
+		want    string
+	}{
+		{"off keeps numeric slug", "", "2", "2"},
+		{"on prefixes numeric slug", "true", "2", "post-2"},
+		{"on prefixes hyphenated numbers", "true", "2024 - 01", "post-2024-01"},
+		{"on leaves mixed slug alone", "true", "Top 10", "top-10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blog := setupTestDB(t)
+			setSetting(blog.db, "prefix_numeric_slugs", tt.setting)
+
+			slug, err := createPost(blog.db, tt.title, "Content", true)
+			if err != nil {
+				t.Fatalf("createPost() error: %v", err)
+			}
+			if slug != tt.want {
+				t.Errorf("expected slug %q, got %q", tt.want, slug)
+			}
+		})
+	}
+}
+
+func TestGetFeedPosts_Chronological(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Oldest", "Content", true)
+	createPost(blog.db, "Newest", "Content", true)
+	createPost(blog.db, "Middle", "Content", true)
+	createPost(blog.db, "Draft", "Content", false)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-01-01 00:00:00' WHERE title = 'Oldest'`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-03-01 00:00:00' WHERE title = 'Newest'`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-02-01 00:00:00' WHERE title = 'Middle'`)
+
+	posts, err := getFeedPosts(blog.db, maxFeedItems)
+	if err != nil {
+		t.Fatalf("getFeedPosts() error: %v", err)
+	}
+
+	var titles []string
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Newest,Middle,Oldest" {
+		t.Errorf("expected feed posts newest first without drafts, got %s", got)
+	}
+}
+
+func TestGetFeedPosts_Limit(t *testing.T) {
+	blog := setupTestDB(t)
+
+	for i := 1; i <= 5; i++ {
+		createPost(blog.db, fmt.Sprintf("Post %d", i), "Content", true)
+		blog.db.Exec(`UPDATE posts SET created_at = ? WHERE id = ?`, fmt.Sprintf("2024-01-0%d 00:00:00", i), i)
+	}
+
+	posts, err := getFeedPosts(blog.db, 2)
+	if err != nil {
+		t.Fatalf("getFeedPosts() error: %v", err)
+	}
+
+	var titles []string
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Post 5,Post 4" {
+		t.Errorf("expected only the 2 newest posts, got %s", got)
+	}
+}
+
+func TestUpdatePostIfUnchanged(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Original", "Content", true)
+	loaded, _ := getPostByID(blog.db, 1)
+	if loaded.Version() == "" {
+		t.Fatal("expected a new post to have a version")
+	}
+
+	// A fresh version saves
+	if _, err := updatePostIfUnchanged(blog.db, 1, loaded.Version(), "First Tab", "", "Content", true, PostDates{}, 1); err != nil {
+		t.Fatalf("updatePostIfUnchanged() error: %v", err)
+	}
+
+	// The now-stale version from the same load is rejected
+	_, err := updatePostIfUnchanged(blog.db, 1, loaded.Version(), "Second Tab", "", "Content", true, PostDates{}, 1)
+	if !errors.Is(err, errEditConflict) {
+		t.Fatalf("expected errEditConflict, got %v", err)
+	}
+
+	post, _ := getPostByID(blog.db, 1)
+	if post.Title != "First Tab" {
+		t.Errorf("expected stale save to leave title 'First Tab', got %q", post.Title)
+	}
+	if post.Version() == loaded.Version() {
+		t.Error("expected saving to change the version")
+	}
+}
+
+func TestGetTranslations(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Original", "Content", true)
+	createPost(blog.db, "French", "Contenu", true)
+	createPost(blog.db, "German Draft", "Inhalt", false)
+	createPost(blog.db, "Unrelated", "Content", true)
+	updatePostMeta(blog.db, 2, PostMeta{Language: "fr", TranslationOf: 1})
+	updatePostMeta(blog.db, 3, PostMeta{Language: "de", TranslationOf: 1})
+
+	tests := []struct {
+		name   string
+		postID int
+		want   []string
+	}{
+		{"original sees translations", 1, []string{"French"}},
+		{"translation sees siblings and original", 2, []string{"Original"}},
+		{"unrelated post", 4, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := getTranslations(blog.db, tt.postID)
+			if err != nil {
+				t.Fatalf("getTranslations() error: %v", err)
+			}
+			var titles []string
+			for _, p := range posts {
+				titles = append(titles, p.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("getTranslations(%d) = %v, want %v", tt.postID, titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPostTags(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Tagged", "Content", true)
+
+	if err := setPostTags(blog.db, 1, []string{"Go", "Web Dev", "go", "!!!"}); err != nil {
+		t.Fatalf("setPostTags() error: %v", err)
+	}
+	tags, _ := getPostTags(blog.db, 1)
+	var slugs []string
+	for _, tag := range tags {
+		slugs = append(slugs, tag.Slug)
+	}
+	if got := strings.Join(slugs, ","); got != "go,web-dev" {
+		t.Errorf("expected tags go,web-dev, got %s", got)
+	}
+
+	// Editing replaces the set rather than adding to it
+	if err := setPostTags(blog.db, 1, []string{"web dev", "SQLite"}); err != nil {
+		t.Fatalf("setPostTags() error: %v", err)
+	}
+	tags, _ = getPostTags(blog.db, 1)
+	slugs = nil
+	for _, tag := range tags {
+		slugs = append(slugs, tag.Slug)
+	}
+	if got := strings.Join(slugs, ","); got != "sqlite,web-dev" {
+		t.Errorf("expected tags sqlite,web-dev, got %s", got)
+	}
+}
+
+func TestGetPostsByTag(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Go Post", "Content", true)
+	createPost(blog.db, "Go Draft", "Content", false)
+	createPost(blog.db, "Other Post", "Content", true)
+	setPostTags(blog.db, 1, []string{"go"})
+	setPostTags(blog.db, 2, []string{"go"})
+	setPostTags(blog.db, 3, []string{"misc"})
+
+	posts, err := getPostsByTag(blog.db, "go", false)
+	if err != nil {
+		t.Fatalf("getPostsByTag() error: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Title != "Go Post" {
+		t.Errorf("expected only 'Go Post', got %v", posts)
+	}
+
+	posts, err = getPostsByTag(blog.db, "go", true)
+	if err != nil {
+		t.Fatalf("getPostsByTag() error: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Errorf("expected the draft to be included, got %v", posts)
+	}
+}
+
+func TestGetRelatedPosts(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Main", "Content", true)
+	createPost(blog.db, "One Shared", "Content", true)
+	createPost(blog.db, "Two Shared", "Content", true)
+	createPost(blog.db, "Draft Shared", "Content", false)
+	setPostTags(blog.db, 1, []string{"go", "web"})
+	setPostTags(blog.db, 2, []string{"go"})
+	setPostTags(blog.db, 3, []string{"go", "web"})
+	setPostTags(blog.db, 4, []string{"go", "web"})
+
+	posts, err := getRelatedPosts(blog.db, 1, 5)
+	if err != nil {
+		t.Fatalf("getRelatedPosts() error: %v", err)
+	}
+	var got []string
+	for _, post := range posts {
+		got = append(got, post.Title)
+	}
+	if want := []string{"Two Shared", "One Shared"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if posts, _ := getRelatedPosts(blog.db, 1, 1); len(posts) != 1 {
+		t.Errorf("expected limit to apply, got %d posts", len(posts))
+	}
+}
+
+func TestGetPostsByTags(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Go and Web", "Content", true)
+	createPost(blog.db, "Just Go", "Content", true)
+	createPost(blog.db, "Just Web", "Content", true)
+	createPost(blog.db, "Neither", "Content", true)
+	setPostTags(blog.db, 1, []string{"go", "web"})
+	setPostTags(blog.db, 2, []string{"go"})
+	setPostTags(blog.db, 3, []string{"web", "misc"})
+	setPostTags(blog.db, 4, []string{"misc"})
+
+	tests := []struct {
+		name     string
+		tags     []string
+		matchAll bool
+		want     []string
+	}{
+		{"all", []string{"go", "web"}, true, []string{"Go and Web"}},
+		{"any", []string{"go", "web"}, false, []string{"Just Web", "Just Go", "Go and Web"}},
+		{"all with duplicate", []string{"go", "go"}, true, []string{"Just Go", "Go and Web"}},
+		{"all with unknown", []string{"go", "nope"}, true, nil},
+		{"empty", nil, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := getPostsByTags(blog.db, tt.tags, tt.matchAll)
+			if err != nil {
+				t.Fatalf("getPostsByTags() error: %v", err)
+			}
+			var got []string
+			for _, post := range posts {
+				got = append(got, post.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getPostsByTags(%v, %v) = %v, want %v", tt.tags, tt.matchAll, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAdjacentPosts_Drafts(t *testing.T) {
+	blog := setupTestDB(t)
+
+	createPost(blog.db, "Published", "Content", true)
+	createPost(blog.db, "Draft", "Content", false)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-01-01 00:00:00' WHERE id = 1`)
+	blog.db.Exec(`UPDATE posts SET created_at = '2024-02-01 00:00:00' WHERE id = 2`)
+	post, _ := getPostByID(blog.db, 1)
+
+	_, next, err := getAdjacentPosts(blog.db, *post, false)
+	if err != nil {
+		t.Fatalf("getAdjacentPosts() error: %v", err)
+	}
+	if next != nil {
+		t.Errorf("expected drafts hidden from visitors, got %q", next.Title)
+	}
+
+	_, next, _ = getAdjacentPosts(blog.db, *post, true)
+	if next == nil || next.Title != "Draft" {
+		t.Errorf("expected draft as next post for admins, got %v", next)
+	}
+}
@@ -3,19 +3,138 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func getSetting(db *sql.DB, key string) (string, error) {
-	var value string
-	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
-	if err == sql.ErrNoRows {
-		return "", nil
+// settingsFormKeys are the settings saved from the Settings form.
+var settingsFormKeys = []string{
+	"intro",
+	"theme",
+	"font",
+	"blog_name",
+	"login_message",
+	"maintenance_mode",
+	"disable_delete_archive",
+	"dashboard_on_login",
+	"feed_max_items",
+	"feed_image_url",
+	"feed_rate_limit",
+	"feed_rate_limit_block",
+	"auto_detect_images",
+	"default_og_image",
+	"negotiate_home_feed",
+	"author_email",
+	"announce_webhook",
+	"prefix_numeric_slugs",
+	"slug_date_prefix",
+	"slug_extra_chars",
+	"reuse_deleted_slugs",
+	"date_label",
+	"home_excerpt_length",
+	"home_excerpt_mode",
+	"home_excerpt_paragraphs",
+	"home_featured",
+	"sitemap_home_changefreq",
+	"sitemap_home_priority",
+	"sitemap_post_changefreq",
+	"sitemap_post_priority",
+}
+
+// settingsCache holds every stored setting in memory, since settings are
+// read on every request but rarely change. It is loaded from the database
+// on first read and kept current by setSetting. The values map is never
+// modified in place, so readers can use it without holding the lock.
+type settingsCache struct {
+	mu     sync.Mutex
+	values map[string]string // nil until loaded
+	loads  int               // database loads, for tests
+}
+
+// settingsCaches maps each *sql.DB to its *settingsCache.
+var settingsCaches sync.Map
+
+func settingsCacheFor(db *sql.DB) *settingsCache {
+	cache, _ := settingsCaches.LoadOrStore(db, &settingsCache{})
+	return cache.(*settingsCache)
+}
+
+// all returns every stored setting, loading them on first use.
+func (c *settingsCache) all(db *sql.DB) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values != nil {
+		return c.values, nil
 	}
+
+	rows, err := db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("loading settings: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("scanning setting: %w", err)
+		}
+		values[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading settings: %w", err)
+	}
+	c.values = values
+	c.loads++
+	return values, nil
+}
+
+// set records a setting that was just written to the database.
+func (c *settingsCache) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		return
+	}
+	values := maps.Clone(c.values)
+	values[key] = value
+	c.values = values
+}
+
+// invalidate drops the cached settings so the next read reloads them, for
+// writes that bypass setSetting.
+func (c *settingsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = nil
+}
+
+func getSetting(db *sql.DB, key string) (string, error) {
+	values, err := settingsCacheFor(db).all(db)
 	if err != nil {
 		return "", fmt.Errorf("getting setting %q: %w", key, err)
 	}
-	return value, nil
+	return values[key], nil
+}
+
+// getSettings fetches several settings at once. Every requested key is
+// present in the result, with "" for keys that aren't stored.
+func getSettings(db *sql.DB, keys ...string) (map[string]string, error) {
+	values, err := settingsCacheFor(db).all(db)
+	if err != nil {
+		return nil, fmt.Errorf("getting settings: %w", err)
+	}
+	settings := make(map[string]string, len(keys))
+	for _, key := range keys {
+		settings[key] = values[key]
+	}
+	return settings, nil
 }
 
 func setSetting(db *sql.DB, key, value string) error {
@@ -26,13 +145,61 @@ func setSetting(db *sql.DB, key, value string) error {
 	if err != nil {
 		return fmt.Errorf("setting %q: %w", key, err)
 	}
+	settingsCacheFor(db).set(key, value)
+	return nil
+}
+
+// exportSettings returns every stored setting that can be set from the
+// Settings form, keyed by name.
+func exportSettings(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, fmt.Errorf("querying settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("scanning setting: %w", err)
+		}
+		if slices.Contains(settingsFormKeys, key) {
+			settings[key] = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating settings: %w", err)
+	}
+	return settings, nil
+}
+
+// importSettings saves settings from an exportSettings backup. It rejects
+// the whole import if any key isn't one of settingsFormKeys.
+func importSettings(db *sql.DB, settings map[string]string) error {
+	for key := range settings {
+		if !slices.Contains(settingsFormKeys, key) {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	for key, value := range settings {
+		if err := setSetting(db, key, value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // getBlogName returns the blog name with precedence:
 // Settings DB → Environment variable → Default
 func getBlogName(db *sql.DB) string {
-	if name, _ := getSetting(db, "blog_name"); name != "" {
+	name, _ := getSetting(db, "blog_name")
+	return blogNameOrDefault(name)
+}
+
+// blogNameOrDefault applies getBlogName's fallbacks to a stored blog_name.
+func blogNameOrDefault(name string) string {
+	if name != "" {
 		return name
 	}
 	if name := os.Getenv("BLOG_NAME"); name != "" {
@@ -40,3 +207,195 @@ func getBlogName(db *sql.DB) string {
 	}
 	return "Blog"
 }
+
+// slugSafeChars are the characters beyond [a-z0-9-] that slug_extra_chars
+// may let into slugs. They are all unreserved in URLs. "." is left out so a
+// slug can never shadow a file route like robots.txt or feed.json.
+const slugSafeChars = "_~"
+
+// getSlugExtraChars returns the characters slug generation keeps besides
+// letters, digits and hyphens, e.g. "_" to preserve imported slugs like
+// my_post. Anything outside slugSafeChars is ignored.
+func getSlugExtraChars(db *sql.DB) string {
+	value, _ := getSetting(db, "slug_extra_chars")
+	var extra []rune
+	for _, c := range slugSafeChars {
+		if strings.ContainsRune(value, c) {
+			extra = append(extra, c)
+		}
+	}
+	return string(extra)
+}
+
+const (
+	// defaultFeedItems is used when feed_max_items is unset or invalid.
+	defaultFeedItems = 20
+	// maxFeedItems caps how many items any feed request can ask for.
+	maxFeedItems = 100
+)
+
+// getFeedMaxItems returns the default number of items per feed.
+func getFeedMaxItems(db *sql.DB) int {
+	value, _ := getSetting(db, "feed_max_items")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return defaultFeedItems
+	}
+	return min(n, maxFeedItems)
+}
+
+const (
+	// defaultFeedRateLimit is how many feed requests per feedRateWindow a
+	// client may make before being flagged. Readers usually poll hourly at most.
+	defaultFeedRateLimit = 60
+	feedRateWindow       = time.Hour
+)
+
+// getFeedRateLimit returns how many feed requests per feedRateWindow a
+// client may make before it is logged, and blocked if feed_rate_limit_block
+// is set. Zero turns the check off.
+func getFeedRateLimit(db *sql.DB) int {
+	value, _ := getSetting(db, "feed_rate_limit")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return defaultFeedRateLimit
+	}
+	return n
+}
+
+// getFeedImageURL returns the channel image for feeds, or "" when unset
+// or not an http(s) URL.
+func getFeedImageURL(db *sql.DB) string {
+	value, _ := getSetting(db, "feed_image_url")
+	if !isHTTPURL(value) {
+		return ""
+	}
+	return value
+}
+
+// getDefaultOGImage returns the site-wide link preview image, or "" when
+// unset or not an http(s) URL.
+func getDefaultOGImage(db *sql.DB) string {
+	value, _ := getSetting(db, "default_og_image")
+	if !isHTTPURL(value) {
+		return ""
+	}
+	return value
+}
+
+// isHomeFeatured reports whether the home page shows the newest post in
+// full above the list of the rest.
+func isHomeFeatured(db *sql.DB) bool {
+	value, _ := getSetting(db, "home_featured")
+	return value == "true"
+}
+
+// emailRegex loosely matches an email address: something@domain.tld.
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// getAuthorEmail returns the author email for feeds, or "" when unset or
+// not shaped like an email address.
+func getAuthorEmail(db *sql.DB) string {
+	value, _ := getSetting(db, "author_email")
+	if !emailRegex.MatchString(value) {
+		return ""
+	}
+	return value
+}
+
+// getHomeExcerptLength returns how many characters of each post the home
+// page previews, or 0 to list titles only.
+func getHomeExcerptLength(db *sql.DB) int {
+	value, _ := getSetting(db, "home_excerpt_length")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// homeExcerptModes are the allowed home_excerpt_mode values: excerpts cut
+// at a character count, or made of whole leading paragraphs.
+var homeExcerptModes = []string{"characters", "paragraphs"}
+
+// getHomeExcerptMode returns how home page excerpts are cut, defaulting to characters.
+func getHomeExcerptMode(db *sql.DB) string {
+	if value, _ := getSetting(db, "home_excerpt_mode"); slices.Contains(homeExcerptModes, value) {
+		return value
+	}
+	return "characters"
+}
+
+// getHomeExcerptParagraphs returns how many paragraphs paragraph-mode
+// excerpts show, defaulting to 1.
+func getHomeExcerptParagraphs(db *sql.DB) int {
+	value, _ := getSetting(db, "home_excerpt_paragraphs")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// getDateLabel returns the wording shown before a post's date, e.g. "Posted on".
+func getDateLabel(db *sql.DB) string {
+	if label, _ := getSetting(db, "date_label"); label != "" {
+		return label
+	}
+	return "Posted on"
+}
+
+// isMaintenanceMode reports whether the site is in maintenance mode.
+// A MAINTENANCE_MODE environment variable overrides the setting.
+func isMaintenanceMode(db *sql.DB) bool {
+	if env := os.Getenv("MAINTENANCE_MODE"); env != "" {
+		return env == "true"
+	}
+	value, _ := getSetting(db, "maintenance_mode")
+	return value == "true"
+}
+
+// isDeleteArchiveEnabled reports whether purged posts are copied to
+// deleted_posts_archive first. It is on unless disable_delete_archive is set.
+func isDeleteArchiveEnabled(db *sql.DB) bool {
+	value, _ := getSetting(db, "disable_delete_archive")
+	return value != "true"
+}
+
+// sitemapChangeFreqs are the <changefreq> values allowed by the sitemap protocol.
+var sitemapChangeFreqs = []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+
+// sitemapHints holds the <changefreq> and <priority> values emitted in the sitemap.
+type sitemapHints struct {
+	HomeChangeFreq string
+	HomePriority   string
+	PostChangeFreq string
+	PostPriority   string
+}
+
+// getSitemapHints returns the sitemap hints from settings, falling back to
+// defaults for missing or invalid values.
+func getSitemapHints(db *sql.DB) sitemapHints {
+	return sitemapHints{
+		HomeChangeFreq: sitemapChangeFreqSetting(db, "sitemap_home_changefreq", "daily"),
+		HomePriority:   sitemapPrioritySetting(db, "sitemap_home_priority", "1.0"),
+		PostChangeFreq: sitemapChangeFreqSetting(db, "sitemap_post_changefreq", "weekly"),
+		PostPriority:   sitemapPrioritySetting(db, "sitemap_post_priority", "0.8"),
+	}
+}
+
+func sitemapChangeFreqSetting(db *sql.DB, key, fallback string) string {
+	if value, _ := getSetting(db, key); slices.Contains(sitemapChangeFreqs, value) {
+		return value
+	}
+	return fallback
+}
+
+func sitemapPrioritySetting(db *sql.DB, key, fallback string) string {
+	value, _ := getSetting(db, key)
+	priority, err := strconv.ParseFloat(value, 64)
+	if err != nil || priority < 0 || priority > 1 {
+		return fallback
+	}
+	return strconv.FormatFloat(priority, 'f', 1, 64)
+}
@@ -57,6 +57,64 @@ func TestGetSetting_NotFound(t *testing.T) {
 	}
 }
 
+func TestGetSettings(t *testing.T) {
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	defer db.Close()
+
+	if err = initDB(db); err != nil {
+		t.Fatalf("initializing test database: %v", err)
+	}
+
+	setSetting(db, "theme", "sepia")
+	setSetting(db, "font", "monospace")
+
+	settings, err := getSettings(db, "theme", "font", "nonexistent")
+	if err != nil {
+		t.Fatalf("getSettings() error: %v", err)
+	}
+
+	want := map[string]string{"theme": "sepia", "font": "monospace", "nonexistent": ""}
+	if len(settings) != len(want) {
+		t.Errorf("expected %d keys, got %v", len(want), settings)
+	}
+	for key, value := range want {
+		if got, ok := settings[key]; !ok || got != value {
+			t.Errorf("settings[%q] = %q (present %v), want %q", key, got, ok, value)
+		}
+	}
+}
+
+func TestSettingsCache(t *testing.T) {
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	defer db.Close()
+
+	if err = initDB(db); err != nil {
+		t.Fatalf("initializing test database: %v", err)
+	}
+
+	cache := settingsCacheFor(db)
+	setSetting(db, "theme", "blue")
+	if value, _ := getSetting(db, "theme"); value != "blue" {
+		t.Errorf("expected 'blue', got '%s'", value)
+	}
+
+	setSetting(db, "theme", "sepia")
+	if value, _ := getSetting(db, "theme"); value != "sepia" {
+		t.Errorf("expected 'sepia' after update, got '%s'", value)
+	}
+	getSettings(db, "theme", "font")
+
+	if cache.loads != 1 {
+		t.Errorf("expected settings to be loaded from the database once, got %d loads", cache.loads)
+	}
+}
+
 func TestSetSetting_Insert(t *testing.T) {
 	db, err := openDB(":memory:")
 	if err != nil {
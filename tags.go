@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// parseTags splits a comma-separated tags form field into tag names,
+// dropping blanks.
+func parseTags(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// setPostTags replaces a post's tags with names. Names are slugified with
+// generateSlug, so "Go" and "go" are the same tag; names that slugify to
+// nothing are ignored. New tags are created as needed.
+func setPostTags(db *sql.DB, postID int, names []string) error {
+	// Read the setting before the transaction holds the connection
+	extraChars := getSlugExtraChars(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning tag update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID); err != nil {
+		return fmt.Errorf("clearing tags for post %d: %w", postID, err)
+	}
+
+	for _, name := range names {
+		slug := generateSlug(name, extraChars)
+		if slug == "" {
+			continue
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO tags (name, slug) VALUES (?, ?)
+			ON CONFLICT(slug) DO NOTHING`, name, slug)
+		if err != nil {
+			return fmt.Errorf("inserting tag %q: %w", slug, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO post_tags (post_id, tag_id)
+			SELECT ?, id FROM tags WHERE slug = ?`, postID, slug)
+		if err != nil {
+			return fmt.Errorf("tagging post %d with %q: %w", postID, slug, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing tag update: %w", err)
+	}
+	return nil
+}
+
+// getPostTags returns a post's tags ordered by name.
+func getPostTags(db *sql.DB, postID int) ([]Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.name, t.slug
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		WHERE pt.post_id = ?
+		ORDER BY t.name`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("querying tags for post %d: %w", postID, err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug); err != nil {
+			return nil, fmt.Errorf("scanning tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating tags: %w", err)
+	}
+	return tags, nil
+}
+
+// getTagBySlug returns the tag with the given slug, or nil if there is none.
+func getTagBySlug(db *sql.DB, slug string) (*Tag, error) {
+	var tag Tag
+	err := db.QueryRow("SELECT id, name, slug FROM tags WHERE slug = ?", slug).Scan(&tag.ID, &tag.Name, &tag.Slug)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning tag %q: %w", slug, err)
+	}
+	return &tag, nil
+}
+
+// getPostsByTag returns posts tagged with tagSlug, newest first. Drafts and
+// scheduled posts are only included when includeDrafts is set.
+func getPostsByTag(db *sql.DB, tagSlug string, includeDrafts bool) ([]Post, error) {
+	return queryPosts(db, `
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE deleted_at IS NULL AND (`+publicPosts+` OR ?2) AND id IN (
+			SELECT pt.post_id FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.slug = ?1
+		)
+		ORDER BY created_at DESC, id DESC`, tagSlug, includeDrafts)
+}
+
+// getPostsByTags returns published posts tagged with every one of
+// tagSlugs when matchAll is set, or with at least one of them otherwise,
+// newest first. An empty set of tags matches no posts.
+func getPostsByTags(db *sql.DB, tagSlugs []string, matchAll bool) ([]Post, error) {
+	var slugs []any
+	seen := make(map[string]bool)
+	for _, slug := range tagSlugs {
+		if slug != "" && !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) == 0 {
+		return nil, nil
+	}
+
+	required := 1
+	if matchAll {
+		required = len(slugs)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(slugs)), ", ")
+	return queryPosts(db, `
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE `+publicPosts+` AND id IN (
+			SELECT pt.post_id FROM post_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE t.slug IN (`+placeholders+`)
+			GROUP BY pt.post_id
+			HAVING COUNT(DISTINCT t.id) >= ?
+		)
+		ORDER BY created_at DESC, id DESC`, append(slugs, required)...)
+}
+
+// getRelatedPosts returns up to limit published posts sharing tags with
+// postID, those sharing the most tags first, then newest first.
+func getRelatedPosts(db *sql.DB, postID, limit int) ([]Post, error) {
+	return queryPosts(db, `
+		SELECT `+postColumns+`
+		FROM posts
+		JOIN (
+			SELECT other.post_id, COUNT(*) AS shared
+			FROM post_tags own
+			JOIN post_tags other ON other.tag_id = own.tag_id AND other.post_id != own.post_id
+			WHERE own.post_id = ?
+			GROUP BY other.post_id
+		) related ON related.post_id = posts.id
+		WHERE `+publicPosts+`
+		ORDER BY related.shared DESC, created_at DESC, id DESC
+		LIMIT ?`, postID, limit)
+}
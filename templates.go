@@ -1,66 +1,572 @@
 package main
 
 import (
+	"fmt"
+	"html"
 	"html/template"
 	"net/url"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var boldRegex = regexp.MustCompile(`\*\*([^*]+)\*\*`)
 var italicRegex = regexp.MustCompile(`\*([^*]+)\*`)
 var linkRegex = regexp.MustCompile(`\[([^\]]+)\]\(((?:[^()]+|\([^()]*\))+)\)`)
+var emojiRegex = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+var headingRegex = regexp.MustCompile(`^(#{1,3}) +(.*\S.*)$`)
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+var unorderedItemRegex = regexp.MustCompile(`^[-*] +(.*\S.*)$`)
+var orderedItemRegex = regexp.MustCompile(`^[0-9]+\. +(.*\S.*)$`)
 
-func format(s string) template.HTML {
-	s = template.HTMLEscapeString(s)
+// quoteRegex matches a "> " quote line after HTML escaping.
+var quoteRegex = regexp.MustCompile(`^&gt; (.*)$`)
+var inlineCodeRegex = regexp.MustCompile("`([^`]+)`")
+var codeLanguageRegex = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+
+// emojiShortcodes maps :name: shortcodes to the emoji format renders them as.
+var emojiShortcodes = map[string]string{
+	"+1":               "👍",
+	"-1":               "👎",
+	"thumbsup":         "👍",
+	"thumbsdown":       "👎",
+	"smile":            "😄",
+	"grin":             "😁",
+	"joy":              "😂",
+	"laughing":         "😆",
+	"wink":             "😉",
+	"blush":            "😊",
+	"heart_eyes":       "😍",
+	"thinking":         "🤔",
+	"neutral_face":     "😐",
+	"sweat_smile":      "😅",
+	"cry":              "😢",
+	"sob":              "😭",
+	"angry":            "😠",
+	"scream":           "😱",
+	"sunglasses":       "😎",
+	"shrug":            "🤷",
+	"wave":             "👋",
+	"clap":             "👏",
+	"pray":             "🙏",
+	"muscle":           "💪",
+	"eyes":             "👀",
+	"heart":            "❤️",
+	"broken_heart":     "💔",
+	"fire":             "🔥",
+	"sparkles":         "✨",
+	"star":             "⭐",
+	"tada":             "🎉",
+	"rocket":           "🚀",
+	"bulb":             "💡",
+	"warning":          "⚠️",
+	"check":            "✔️",
+	"white_check_mark": "✅",
+	"x":                "❌",
+	"question":         "❓",
+	"coffee":           "☕",
+	"beer":             "🍺",
+	"pizza":            "🍕",
+	"sunny":            "☀️",
+	"cloud":            "☁️",
+	"snowflake":        "❄️",
+	"zap":              "⚡",
+	"book":             "📖",
+	"memo":             "📝",
+	"computer":         "💻",
+	"bug":              "🐛",
+	"cat":              "🐱",
+	"dog":              "🐶",
+	"football":         "🏈",
+	"100":              "💯",
+}
+
+// replaceEmoji swaps known :shortcode: tokens for emoji, leaving unknown ones as-is.
+func replaceEmoji(s string) string {
+	return emojiRegex.ReplaceAllStringFunc(s, func(match string) string {
+		if emoji, ok := emojiShortcodes[match[1:len(match)-1]]; ok {
+			return emoji
+		}
+		return match
+	})
+}
+
+// hasScheme reports whether rawURL parses and uses one of schemes, so
+// javascript: and data: URLs never make it into an attribute.
+func hasScheme(rawURL string, schemes ...string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(parsedURL.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatInline renders the inline markup of one block: code spans, images,
+// emoji, links, bold and italics. s must already be HTML-escaped.
+func formatInline(s string) string {
+	// Code spans and images are set aside behind NUL placeholders, which
+	// escaped content can't contain, so the other passes leave them alone
+	var spans []string
+	setAside := func(html string) string {
+		spans = append(spans, html)
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	}
+	s = inlineCodeRegex.ReplaceAllStringFunc(s, func(match string) string {
+		return setAside("<code>" + match[1:len(match)-1] + "</code>")
+	})
+	s = imageRegex.ReplaceAllStringFunc(s, func(match string) string {
+		parts := imageRegex.FindStringSubmatch(match)
+		alt, rawURL := parts[1], parts[2]
+		if !hasScheme(rawURL, "http", "https") {
+			return match
+		}
+		return setAside(`<img src="` + rawURL + `" alt="` + alt + `" loading="lazy">`)
+	})
+
+	s = replaceEmoji(s)
 	s = linkRegex.ReplaceAllStringFunc(s, func(match string) string {
 		parts := linkRegex.FindStringSubmatch(match)
 		if len(parts) != 3 {
 			return match
 		}
 		text, rawURL := parts[1], parts[2]
-		// Parse and validate URL scheme
-		parsedURL, err := url.Parse(rawURL)
-		if err != nil {
-			return match
-		}
-		scheme := strings.ToLower(parsedURL.Scheme)
-		if scheme != "http" && scheme != "https" && scheme != "mailto" {
+		if !hasScheme(rawURL, "http", "https", "mailto") {
 			return match
 		}
 		return `<a href="` + rawURL + `" target="_blank" rel="noopener">` + text + `</a>`
 	})
 	s = boldRegex.ReplaceAllString(s, "<strong>$1</strong>")
 	s = italicRegex.ReplaceAllString(s, "<em>$1</em>")
+	for i, span := range spans {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return s
+}
+
+func format(s string) template.HTML {
+	s = template.HTMLEscapeString(s)
+	lines := strings.Split(s, "\n")
 
-	paragraphs := strings.Split(s, "\n\n")
-	var result []string
+	var result, paragraph, items, quote []string
+	var listTag string
+	ids := headingIDs{}
 
-	for _, p := range paragraphs {
-		if p = strings.TrimSpace(p); p != "" {
-			p = strings.ReplaceAll(p, "\n", "<br>")
+	// Inline markup is applied per block so that list markers and
+	// emphasis asterisks can't pair up across block boundaries
+	endParagraph := func() {
+		if p := strings.TrimSpace(strings.Join(paragraph, "\n")); p != "" {
+			p = strings.ReplaceAll(formatInline(p), "\n", "<br>")
 			result = append(result, "<p>"+p+"</p>")
 		}
+		paragraph = nil
+	}
+	endList := func() {
+		if len(items) > 0 {
+			var list strings.Builder
+			list.WriteString("<" + listTag + ">")
+			for _, item := range items {
+				list.WriteString("<li>" + formatInline(item) + "</li>")
+			}
+			list.WriteString("</" + listTag + ">")
+			result = append(result, list.String())
+		}
+		items, listTag = nil, ""
+	}
+	endQuote := func() {
+		if len(quote) > 0 {
+			q := strings.ReplaceAll(formatInline(strings.Join(quote, "\n")), "\n", "<br>")
+			result = append(result, "<blockquote>"+q+"</blockquote>")
+		}
+		quote = nil
+	}
+	endBlocks := func() {
+		endParagraph()
+		endList()
+		endQuote()
+	}
+	addItem := func(tag, text string) {
+		endParagraph()
+		endQuote()
+		if listTag != tag {
+			endList()
+			listTag = tag
+		}
+		items = append(items, strings.TrimSpace(text))
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fence := strings.TrimSpace(line); strings.HasPrefix(fence, "```") {
+			if end := closingFence(lines[i+1:]); end >= 0 {
+				endBlocks()
+				class := ""
+				if lang := strings.TrimPrefix(fence, "```"); codeLanguageRegex.MatchString(lang) {
+					class = ` class="language-` + lang + `"`
+				}
+				code := strings.Join(lines[i+1:i+1+end], "\n")
+				result = append(result, "<pre><code"+class+">"+code+"</code></pre>")
+				i += end + 1
+				continue
+			}
+			// An unclosed fence is just text
+		}
+		if strings.TrimSpace(line) == "" {
+			endBlocks()
+			continue
+		}
+		if m := headingRegex.FindStringSubmatch(line); m != nil {
+			endBlocks()
+			level, text := len(m[1]), formatInline(strings.TrimSpace(m[2]))
+			id := ids.next(html.UnescapeString(tagRegex.ReplaceAllString(text, "")))
+			result = append(result, fmt.Sprintf(`<h%d id="%s">%s</h%d>`, level, id, text, level))
+			continue
+		}
+		if m := quoteRegex.FindStringSubmatch(line); m != nil {
+			endParagraph()
+			endList()
+			quote = append(quote, m[1])
+			continue
+		}
+		if m := unorderedItemRegex.FindStringSubmatch(line); m != nil {
+			addItem("ul", m[1])
+			continue
+		}
+		if m := orderedItemRegex.FindStringSubmatch(line); m != nil {
+			addItem("ol", m[1])
+			continue
+		}
+		// Text right after a list or quote starts a new paragraph
+		endList()
+		endQuote()
+		paragraph = append(paragraph, line)
 	}
+	endBlocks()
 
 	return template.HTML(strings.Join(result, "\n"))
 }
 
-func loadTemplates() map[string]*template.Template {
+// closingFence returns the index of the first ``` line in lines, or -1 if
+// the code block is never closed.
+func closingFence(lines []string) int {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "```" {
+			return i
+		}
+	}
+	return -1
+}
+
+var (
+	emptyLinkTargetRegex = regexp.MustCompile(`\[[^\]]*\]\(\s*\)`)
+	missingAltTextRegex  = regexp.MustCompile(`!\[\s*\]\(`)
+)
+
+// validateMarkdown returns warnings about likely mistakes in content, such
+// as an unclosed ** or a link with no target. It is advisory only; content
+// with warnings still saves and renders.
+func validateMarkdown(content string) []string {
+	var warnings []string
+
+	var fences int
+	var prose strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fences++
+			continue
+		}
+		// Markup inside code blocks is shown literally, so skip it
+		if fences%2 == 0 {
+			prose.WriteString(line + "\n")
+		}
+	}
+	text := prose.String()
+
+	if fences%2 != 0 {
+		warnings = append(warnings, "A ``` code fence is never closed")
+	}
+	if strings.Count(text, "**")%2 != 0 {
+		warnings = append(warnings, "A ** for bold text is never closed")
+	}
+	if emptyLinkTargetRegex.MatchString(text) {
+		warnings = append(warnings, "A link has no target URL")
+	}
+	if missingAltTextRegex.MatchString(text) {
+		warnings = append(warnings, "An image has no alt text")
+	}
+	return warnings
+}
+
+var imageRegex = regexp.MustCompile(`!\[([^\]]*)\]\(([^()\s]+)\)`)
+
+// firstImageURL returns the URL of the first ![alt](url) image in content
+// that is an http(s) URL or a site-relative path, or "" if there is none.
+func firstImageURL(content string) string {
+	for _, match := range imageRegex.FindAllStringSubmatch(content, -1) {
+		target := match[2]
+		if isHTTPURL(target) || (strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")) {
+			return target
+		}
+	}
+	return ""
+}
+
+// paragraphBlocks splits content into its non-empty blank-line-separated blocks.
+func paragraphBlocks(content string) []string {
+	var blocks []string
+	for _, block := range strings.Split(content, "\n\n") {
+		if block = strings.TrimSpace(block); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// paragraphCount returns how many paragraphs content renders as.
+func paragraphCount(content string) int {
+	return len(paragraphBlocks(content))
+}
+
+// leadingParagraphs renders only the first n paragraphs of content.
+func leadingParagraphs(content string, n int) template.HTML {
+	blocks := paragraphBlocks(content)
+	if n < len(blocks) {
+		blocks = blocks[:n]
+	}
+	return format(strings.Join(blocks, "\n\n"))
+}
+
+// absoluteLinks rewrites site-relative markdown link targets like
+// [x](/other-post) to absolute URLs under baseURL, for output such as feeds
+// that is read away from the site. Protocol-relative and absolute URLs are
+// left alone.
+func absoluteLinks(content, baseURL string) string {
+	return linkRegex.ReplaceAllStringFunc(content, func(match string) string {
+		parts := linkRegex.FindStringSubmatch(match)
+		text, target := parts[1], parts[2]
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+			return match
+		}
+		return "[" + text + "](" + baseURL + target + ")"
+	})
+}
+
+// blockMarkerRegex matches markdown block markers at the start of a line:
+// headings, blockquotes and list bullets.
+var blockMarkerRegex = regexp.MustCompile(`(?m)^[ \t]*(?:#{1,6}|>|[-*]|[0-9]+\.)[ \t]+`)
+
+// plainText reduces markdown content to readable text for places that can't
+// show markup, like meta descriptions: link URLs and formatting markers are
+// dropped and whitespace is collapsed to single spaces.
+func plainText(content string) string {
+	s := blockMarkerRegex.ReplaceAllString(content, "")
+	s = linkRegex.ReplaceAllString(s, "$1")
+	s = boldRegex.ReplaceAllString(s, "$1")
+	s = italicRegex.ReplaceAllString(s, "$1")
+	s = strings.ReplaceAll(s, "`", "")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// headingIDs hands out anchor ids for the headings of a single post. Ids are
+// the slugified heading text, with a numeric suffix for repeats, so the same
+// content always produces the same ids and section links stay stable.
+type headingIDs map[string]bool
+
+// next returns the id for a heading with the given text.
+func (ids headingIDs) next(text string) string {
+	base := generateSlug(text, "")
+	if base == "" {
+		base = "section"
+	}
+	id := base
+	for n := 2; ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids[id] = true
+	return id
+}
+
+// voidElements never have closing tags, so summarize doesn't track them.
+var voidElements = map[string]bool{"br": true, "img": true, "hr": true}
+
+// summarize renders content with format and trims the resulting HTML to
+// roughly max visible characters. It only cuts at whitespace in text, never
+// inside a tag or entity, and closes any tags left open so the excerpt is
+// always well-formed.
+func summarize(content string, max int) template.HTML {
+	rendered := string(format(content))
+
+	var out strings.Builder
+	var open []string
+	visible := 0
+
+	for i := 0; i < len(rendered); {
+		switch rendered[i] {
+		case '<':
+			end := strings.IndexByte(rendered[i:], '>')
+			if end == -1 {
+				end = len(rendered) - i - 1
+			}
+			tag := rendered[i : i+end+1]
+			out.WriteString(tag)
+			i += end + 1
+
+			name := strings.TrimPrefix(strings.Trim(tag, "<>/"), "/")
+			if sp := strings.IndexAny(name, " \t\n"); sp != -1 {
+				name = name[:sp]
+			}
+			switch {
+			case strings.HasPrefix(tag, "</"):
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			case !voidElements[name] && !strings.HasSuffix(tag, "/>"):
+				open = append(open, name)
+			}
+		case '&':
+			end := strings.IndexByte(rendered[i:], ';')
+			if end == -1 {
+				end = 0
+			}
+			out.WriteString(rendered[i : i+end+1])
+			i += end + 1
+			visible++
+		default:
+			r, size := utf8.DecodeRuneInString(rendered[i:])
+			if visible >= max && unicode.IsSpace(r) {
+				out.WriteString("…")
+				for j := len(open) - 1; j >= 0; j-- {
+					out.WriteString("</" + open[j] + ">")
+				}
+				return template.HTML(out.String())
+			}
+			out.WriteString(rendered[i : i+size])
+			i += size
+			visible++
+		}
+	}
+
+	return template.HTML(rendered)
+}
+
+// whitespaceRegex matches runs of whitespace for minifyHTML to collapse.
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// preservedElements keep their contents verbatim when minifying, since
+// whitespace inside them is significant.
+var preservedElements = []string{"pre", "code", "textarea", "script"}
+
+// minifyHTML collapses every run of whitespace in rendered HTML to a single
+// space, which browsers treat the same, except inside preservedElements.
+func minifyHTML(s string) string {
+	var out strings.Builder
+	for {
+		// Find the earliest preserved element still ahead
+		start, name := -1, ""
+		for _, el := range preservedElements {
+			if i := indexTag(s, el); i != -1 && (start == -1 || i < start) {
+				start, name = i, el
+			}
+		}
+		if start == -1 {
+			out.WriteString(whitespaceRegex.ReplaceAllString(s, " "))
+			return strings.TrimSpace(out.String())
+		}
+
+		end := strings.Index(s[start:], "</"+name+">")
+		if end == -1 {
+			end = len(s)
+		} else {
+			end += start + len("</"+name+">")
+		}
+		out.WriteString(whitespaceRegex.ReplaceAllString(s[:start], " "))
+		out.WriteString(s[start:end])
+		s = s[end:]
+	}
+}
+
+// indexTag returns the index of the first <name> or <name ...> opening tag
+// in s, or -1. Longer names sharing the prefix, like <pref>, don't match.
+func indexTag(s, name string) int {
+	for offset := 0; ; {
+		i := strings.Index(s[offset:], "<"+name)
+		if i == -1 {
+			return -1
+		}
+		i += offset
+		if rest := s[i+len(name)+1:]; rest == "" || rest[0] == '>' || unicode.IsSpace(rune(rest[0])) {
+			return i
+		}
+		offset = i + 1
+	}
+}
+
+// wordsPerMinute is the reading speed readingTime assumes.
+const wordsPerMinute = 200
+
+// readingTime estimates how many minutes content takes to read, counting
+// words in the raw markdown. It is never less than a minute.
+func readingTime(content string) int {
+	return max(1, len(strings.Fields(content))/wordsPerMinute)
+}
+
+// detailTemplates are the layouts a post can choose to be shown with. The
+// first is the default.
+var detailTemplates = []string{"detail.html", "link.html", "photo.html"}
+
+// firstLinkURL returns the target of the first http(s) [text](url) link in
+// content, ignoring images, or "" if there is none.
+func firstLinkURL(content string) string {
+	for _, match := range linkRegex.FindAllStringSubmatchIndex(content, -1) {
+		if match[0] > 0 && content[match[0]-1] == '!' {
+			continue
+		}
+		if target := content[match[4]:match[5]]; isHTTPURL(target) {
+			return target
+		}
+	}
+	return ""
+}
+
+// loadTemplates parses every page template in the templates directory.
+func loadTemplates() (map[string]*template.Template, error) {
+	return loadTemplatesFrom("templates")
+}
+
+// loadTemplatesFrom parses each page template in dir together with
+// base.html, returning an error naming the first file that fails.
+func loadTemplatesFrom(dir string) (map[string]*template.Template, error) {
 	templates := make(map[string]*template.Template)
-	pages := []string{"home.html", "detail.html", "create.html", "edit.html", "delete.html", "settings.html", "admin.html"}
+	pages := []string{"home.html", "create.html", "edit.html", "delete.html", "trash.html", "settings.html", "admin.html", "error.html", "search.html", "dashboard.html", "tag.html"}
+	pages = append(pages, detailTemplates...)
 
 	funcs := template.FuncMap{
-		"format": format,
+		"format":            format,
+		"summarize":         summarize,
+		"leadingParagraphs": leadingParagraphs,
+		"paragraphCount":    paragraphCount,
+		"userName":          userName,
+		"firstLinkURL":      firstLinkURL,
+		"firstImageURL":     firstImageURL,
+		"readingTime":       readingTime,
 	}
 
 	for _, page := range pages {
-		templates[page] = template.Must(
-			template.New("").Funcs(funcs).ParseFiles(
-				"templates/base.html",
-				"templates/"+page,
-			))
+		tmpl, err := template.New("").Funcs(funcs).ParseFiles(
+			filepath.Join(dir, "base.html"),
+			filepath.Join(dir, page),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %s: %w", page, err)
+		}
+		templates[page] = tmpl
 	}
 
-	return templates
+	return templates, nil
 }
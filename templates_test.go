@@ -2,6 +2,9 @@ package main
 
 import (
 	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -111,6 +114,171 @@ func TestFormat(t *testing.T) {
 			input: "Check [**bold link**](https://example.com)",
 			want:  `<p>Check <a href="https://example.com" target="_blank" rel="noopener"><strong>bold link</strong></a></p>`,
 		},
+		{
+			name:  "emoji shortcode",
+			input: "Shipped it :tada:",
+			want:  "<p>Shipped it 🎉</p>",
+		},
+		{
+			name:  "unknown emoji shortcode stays literal",
+			input: "Hmm :not_an_emoji:",
+			want:  "<p>Hmm :not_an_emoji:</p>",
+		},
+		{
+			name:  "adjacent emoji shortcodes",
+			input: ":fire::rocket:",
+			want:  "<p>🔥🚀</p>",
+		},
+		{
+			name:  "heading level 1",
+			input: "# Title",
+			want:  `<h1 id="title">Title</h1>`,
+		},
+		{
+			name:  "heading level 2",
+			input: "## Section",
+			want:  `<h2 id="section">Section</h2>`,
+		},
+		{
+			name:  "heading level 3",
+			input: "### Subsection",
+			want:  `<h3 id="subsection">Subsection</h3>`,
+		},
+		{
+			name:  "heading splits paragraph",
+			input: "Before\n## Middle\nAfter",
+			want:  "<p>Before</p>\n<h2 id=\"middle\">Middle</h2>\n<p>After</p>",
+		},
+		{
+			name:  "heading with markup and repeated text",
+			input: "## **Notes** & more\n\n## Notes & more",
+			want:  "<h2 id=\"notes-more\"><strong>Notes</strong> &amp; more</h2>\n<h2 id=\"notes-more-2\">Notes &amp; more</h2>",
+		},
+		{
+			name:  "hash without space stays literal",
+			input: "#hashtag",
+			want:  "<p>#hashtag</p>",
+		},
+		{
+			name:  "four hashes stay literal",
+			input: "#### Too deep",
+			want:  "<p>#### Too deep</p>",
+		},
+		{
+			name:  "unordered list",
+			input: "- one\n- two\n* three",
+			want:  "<ul><li>one</li><li>two</li><li>three</li></ul>",
+		},
+		{
+			name:  "ordered list",
+			input: "1. first\n2. second\n3. third",
+			want:  "<ol><li>first</li><li>second</li><li>third</li></ol>",
+		},
+		{
+			name:  "paragraph then list",
+			input: "Things I like:\n- **tea**\n- *cake*\n\nThe end",
+			want:  "<p>Things I like:</p>\n<ul><li><strong>tea</strong></li><li><em>cake</em></li></ul>\n<p>The end</p>",
+		},
+		{
+			name:  "text after list starts a paragraph",
+			input: "- one\nafterwards",
+			want:  "<ul><li>one</li></ul>\n<p>afterwards</p>",
+		},
+		{
+			name:  "switching list type starts a new list",
+			input: "- bullet\n1. numbered",
+			want:  "<ul><li>bullet</li></ul>\n<ol><li>numbered</li></ol>",
+		},
+		{
+			name:  "fenced code block",
+			input: "Run this:\n```\nmake build\n\n  ./blog\n```\nDone",
+			want:  "<p>Run this:</p>\n<pre><code>make build\n\n  ./blog</code></pre>\n<p>Done</p>",
+		},
+		{
+			name:  "fenced code block with language",
+			input: "```go\nif a < b {\n}\n```",
+			want:  "<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>",
+		},
+		{
+			name:  "fenced code block skips markup",
+			input: "```\n*asterisks* **stay** [put](https://example.com) :tada:\n- not a list\n```",
+			want:  "<pre><code>*asterisks* **stay** [put](https://example.com) :tada:\n- not a list</code></pre>",
+		},
+		{
+			name:  "unclosed fence stays literal",
+			input: "```\n*still formatted*",
+			want:  "<p>```<br><em>still formatted</em></p>",
+		},
+		{
+			name:  "two inline code spans",
+			input: "Use `go build` then `go test`",
+			want:  "<p>Use <code>go build</code> then <code>go test</code></p>",
+		},
+		{
+			name:  "inline code skips markup",
+			input: "Glob with `*.go` and *style* `[a](https://example.com)`",
+			want:  "<p>Glob with <code>*.go</code> and <em>style</em> <code>[a](https://example.com)</code></p>",
+		},
+		{
+			name:  "inline code escaped",
+			input: "`<b>`",
+			want:  "<p><code>&lt;b&gt;</code></p>",
+		},
+		{
+			name:  "unmatched backtick stays literal",
+			input: "A lone ` backtick",
+			want:  "<p>A lone ` backtick</p>",
+		},
+		{
+			name:  "one-line quote",
+			input: "&gt; not a quote\n\n> To be or not to be",
+			want:  "<p>&amp;gt; not a quote</p>\n<blockquote>To be or not to be</blockquote>",
+		},
+		{
+			name:  "multi-line quote",
+			input: "> First line with **bold**\n> and a [link](https://example.com)",
+			want:  `<blockquote>First line with <strong>bold</strong><br>and a <a href="https://example.com" target="_blank" rel="noopener">link</a></blockquote>`,
+		},
+		{
+			name:  "quote then paragraph",
+			input: "> Quoted\n\nMy reply",
+			want:  "<blockquote>Quoted</blockquote>\n<p>My reply</p>",
+		},
+		{
+			name:  "paragraph then quote",
+			input: "She said:\n> Hello",
+			want:  "<p>She said:</p>\n<blockquote>Hello</blockquote>",
+		},
+		{
+			name:  "image",
+			input: "![A *sunny* day](https://example.com/sun.jpg)",
+			want:  `<p><img src="https://example.com/sun.jpg" alt="A *sunny* day" loading="lazy"></p>`,
+		},
+		{
+			name:  "image with empty alt",
+			input: "![](https://example.com/sun.jpg)",
+			want:  `<p><img src="https://example.com/sun.jpg" alt="" loading="lazy"></p>`,
+		},
+		{
+			name:  "image alt escaped",
+			input: `![say "hi" <b>](https://example.com/hi.jpg)`,
+			want:  `<p><img src="https://example.com/hi.jpg" alt="say &#34;hi&#34; &lt;b&gt;" loading="lazy"></p>`,
+		},
+		{
+			name:  "data URI image blocked",
+			input: "![x](data:image/svg+xml;base64,PHN2Zz4=)",
+			want:  "<p>![x](data:image/svg+xml;base64,PHN2Zz4=)</p>",
+		},
+		{
+			name:  "javascript image blocked",
+			input: "![x](javascript:alert(1))",
+			want:  "<p>![x](javascript:alert(1))</p>",
+		},
+		{
+			name:  "image inside link",
+			input: "[![logo](https://example.com/logo.png)](https://example.com)",
+			want:  `<p><a href="https://example.com" target="_blank" rel="noopener"><img src="https://example.com/logo.png" alt="logo" loading="lazy"></a></p>`,
+		},
 		{
 			name:  "empty string",
 			input: "",
@@ -127,3 +295,271 @@ func TestFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestFirstImageURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"no image", "Just text and a [link](https://example.com)", ""},
+		{"absolute image", "Intro\n\n![cover](https://example.com/a.png) and ![b](https://example.com/b.png)", "https://example.com/a.png"},
+		{"relative image", "![logo](/static/logo.jpg)", "/static/logo.jpg"},
+		{"skips unsafe image", "![x](javascript:alert(1)) ![y](https://example.com/y.gif)", "https://example.com/y.gif"},
+		{"skips data URI", "![x](data:image/png;base64,AAAA)", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstImageURL(tt.content); got != tt.want {
+				t.Errorf("firstImageURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstLinkURL(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"No links here", ""},
+		{"See [this](https://example.com/a) and [that](https://example.com/b)", "https://example.com/a"},
+		{"![photo](https://example.com/p.jpg) then [link](https://example.com/l)", "https://example.com/l"},
+		{"[mail](mailto:me@example.com)", ""},
+	}
+
+	for _, tt := range tests {
+		if got := firstLinkURL(tt.content); got != tt.want {
+			t.Errorf("firstLinkURL(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"empty", "", 1},
+		{"short", "Just a few words", 1},
+		{"600 words", strings.Repeat("word ", 600), 3},
+		{"rounds down", strings.Repeat("word ", 399), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readingTime(tt.content); got != tt.want {
+				t.Errorf("readingTime() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"clean content", "Some **bold** text, a [link](https://example.com) and ![a cat](/cat.png)", nil},
+		{"unmatched bold", "Some **bold text", []string{"A ** for bold text is never closed"}},
+		{"unterminated code fence", "Intro\n\n```\nfmt.Println()", []string{"A ``` code fence is never closed"}},
+		{"empty link target", "A [link]() here", []string{"A link has no target URL"}},
+		{"image without alt text", "![](/cat.png)", []string{"An image has no alt text"}},
+		{"markup inside code is ignored", "```\n**not bold\n[x]()\n```", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateMarkdown(tt.content)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("validateMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbsoluteLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"relative link", "See [this](/other-post)", "See [this](https://example.com/other-post)"},
+		{"relative image", "![logo](/static/foo.png)", "![logo](https://example.com/static/foo.png)"},
+		{"absolute untouched", "[site](https://other.com/x)", "[site](https://other.com/x)"},
+		{"protocol-relative untouched", "[cdn](//cdn.example.com/x)", "[cdn](//cdn.example.com/x)"},
+		{"plain path text untouched", "Files live in /static/", "Files live in /static/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := absoluteLinks(tt.content, "https://example.com"); got != tt.want {
+				t.Errorf("absoluteLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bold and italic", "This is **bold** and *italic*", "This is bold and italic"},
+		{"link keeps text only", "Read [the docs](https://example.com/docs) first", "Read the docs first"},
+		{"headings", "# Title\n\n## Section\nBody", "Title Section Body"},
+		{"quotes and lists", "> quoted\n- one\n- two\n1. first", "quoted one two first"},
+		{"collapses whitespace", "  spaced   out\n\n\ntext  ", "spaced out text"},
+		{"hash without space stays", "#hashtag", "#hashtag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plainText(tt.content); got != tt.want {
+				t.Errorf("plainText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadingIDs(t *testing.T) {
+	ids := headingIDs{}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Intro", "intro"},
+		{"Intro", "intro-2"},
+		{"Getting Started!", "getting-started"},
+		{"Intro", "intro-3"},
+		{"Intro 4", "intro-4"},
+		{"Intro", "intro-5"},
+		{"???", "section"},
+	}
+
+	for _, tt := range tests {
+		if got := ids.next(tt.text); got != tt.want {
+			t.Errorf("next(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "collapses whitespace between tags",
+			input: "<ul>\n    <li>One</li>\n    <li>Two</li>\n</ul>\n",
+			want:  "<ul> <li>One</li> <li>Two</li> </ul>",
+		},
+		{
+			name:  "preserves pre blocks",
+			input: "<div>\n  <pre><code>func main() {\n    fmt.Println()\n}</code></pre>\n</div>",
+			want:  "<div> <pre><code>func main() {\n    fmt.Println()\n}</code></pre> </div>",
+		},
+		{
+			name:  "preserves textarea contents",
+			input: "<form>\n  <textarea name=\"content\">line one\n\n  line two</textarea>\n</form>",
+			want:  "<form> <textarea name=\"content\">line one\n\n  line two</textarea> </form>",
+		},
+		{
+			name:  "similar tag names are not preserved",
+			input: "<pref>\n  x</pref>\n<pre>\n  y</pre>",
+			want:  "<pref> x</pref> <pre>\n  y</pre>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minifyHTML(tt.input); got != tt.want {
+				t.Errorf("minifyHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	templates, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("loadTemplates() error: %v", err)
+	}
+	if templates["home.html"] == nil {
+		t.Error("expected home.html to be loaded")
+	}
+}
+
+func TestLoadTemplatesFrom_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	base, err := os.ReadFile("templates/base.html")
+	if err != nil {
+		t.Fatalf("reading base template: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "base.html"), base, 0o644); err != nil {
+		t.Fatalf("writing base template: %v", err)
+	}
+
+	_, err = loadTemplatesFrom(dir)
+	if err == nil {
+		t.Fatal("expected error for missing page templates")
+	}
+	if !strings.Contains(err.Error(), "home.html") {
+		t.Errorf("expected error to name the missing file, got %q", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		max     int
+		want    template.HTML
+	}{
+		{
+			name:    "short content unchanged",
+			content: "Just a line",
+			max:     50,
+			want:    "<p>Just a line</p>",
+		},
+		{
+			name:    "cut after link keeps anchor closed",
+			content: "Check out [my site](https://example.com) for more words here",
+			max:     15,
+			want:    `<p>Check out <a href="https://example.com" target="_blank" rel="noopener">my site</a>…</p>`,
+		},
+		{
+			name:    "cut inside bold closes strong",
+			content: "**bold words that go on** and on",
+			max:     6,
+			want:    "<p><strong>bold words…</strong></p>",
+		},
+		{
+			name:    "never splits a link's markdown",
+			content: "[a link with a long label](https://example.com) trailing",
+			max:     3,
+			want:    `<p><a href="https://example.com" target="_blank" rel="noopener">a link…</a></p>`,
+		},
+		{
+			name:    "entities count as one character",
+			content: "Tom & Jerry forever",
+			max:     5,
+			want:    "<p>Tom &amp;…</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(tt.content, tt.max)
+			if got != tt.want {
+				t.Errorf("summarize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}